@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shihyuho/kubectl-jqlogs/pkg/jqlogs"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// completionTimeout bounds the kubectl calls made while completing.
+const completionTimeout = "5s"
+
+// kubectlComplete runs kubectl's own completion of "kubectl logs" for args, the last one
+// being completed. Replaced in tests.
+var kubectlComplete = func(args []string) []byte {
+	cmdArgs := append([]string{cobra.ShellCompRequestCmd, "logs", "--request-timeout=" + completionTimeout}, args...)
+	out, _ := exec.Command("kubectl", cmdArgs...).Output()
+	return out
+}
+
+// sampleRecords reads recent JSON records of the selected logs. Replaced in tests.
+var sampleRecords = func(kubectlArgs []string, opts jqlogs.JqFlagOptions) []any {
+	runner := jqlogs.NewDefaultRunner()
+	runner.Stderr = io.Discard
+	var records []any
+	args := append(kubectlArgs, "--request-timeout="+completionTimeout)
+	runner.SampleRecords(args, opts, jqlogs.CompletionSampleLines, func(record any) {
+		records = append(records, record)
+	})
+	return records
+}
+
+// isCompletionRequest reports whether args (without the program name) are a shell
+// completion request, to answer with complete rather than cobra.
+func isCompletionRequest(args []string) bool {
+	return len(args) >= 2 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd)
+}
+
+// complete answers a completion request for the root command, printing in cobra's
+// format: one completion per line, then the directive. Cobra can't complete it itself,
+// since flags are not parsed (DisableFlagParsing) and only kubectl knows the pods,
+// namespaces and containers. args are the words typed so far, the last one being completed.
+func complete(args []string, out io.Writer) {
+	descriptions := args[0] == cobra.ShellCompRequestCmd
+	prior, toComplete := args[1:len(args)-1], args[len(args)-1]
+	completions, directive := completeArgs(prior, toComplete)
+	for _, c := range completions {
+		if !descriptions {
+			c, _, _ = strings.Cut(c, "\t")
+		}
+		fmt.Fprintln(out, c)
+	}
+	fmt.Fprintf(out, ":%d\n", directive)
+}
+
+func completeArgs(prior []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// After "--": field paths of the selected pod's recent records
+	if slices.Contains(prior, "--") {
+		kubectlArgs, _, opts, _, _, err := jqlogs.ParseArgs(prior)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return jqlogs.CompleteFieldPaths(sampleRecords(kubectlArgs, opts), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// The value of a jqlogs flag
+	if n := len(prior); n > 0 {
+		if flag := lookupFlag(prior[n-1]); flag != nil && flag.Value.Type() != "bool" {
+			if fn, ok := rootCmd.GetFlagCompletionFunc(flag.Name); ok {
+				return fn(rootCmd, prior[:n-1], toComplete)
+			}
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+	}
+
+	// Everything else is kubectl's, with our flags added
+	kubectlArgs, _, _, _, _, err := jqlogs.ParseArgs(prior)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	completions, directive := parseCompletions(kubectlComplete(append(kubectlArgs, toComplete)))
+	if strings.HasPrefix(toComplete, "-") {
+		completions = append(flagCompletions(toComplete), completions...)
+	}
+	return completions, directive
+}
+
+// lookupFlag returns the jqlogs flag named by arg (--name or -x), if any.
+func lookupFlag(arg string) *pflag.Flag {
+	if name, ok := strings.CutPrefix(arg, "--"); ok {
+		return rootCmd.Flags().Lookup(name)
+	}
+	if len(arg) == 2 && arg[0] == '-' {
+		return rootCmd.Flags().ShorthandLookup(arg[1:])
+	}
+	return nil
+}
+
+// flagCompletions returns the jqlogs flags starting with toComplete, with their usage.
+// Shorthands are only listed for a lone "-", like cobra does.
+func flagCompletions(toComplete string) []string {
+	var completions []string
+	rootCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden {
+			return
+		}
+		if name := "--" + flag.Name; strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name+"\t"+flag.Usage)
+		}
+		if flag.Shorthand != "" && toComplete == "-" {
+			completions = append(completions, "-"+flag.Shorthand+"\t"+flag.Usage)
+		}
+	})
+	return completions
+}
+
+// parseCompletions reads the output of a __complete request. Without a directive line
+// (e.g. kubectl is not installed), file completion is turned off.
+func parseCompletions(out []byte) ([]string, cobra.ShellCompDirective) {
+	var completions []string
+	directive := cobra.ShellCompDirectiveNoFileComp
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if d, ok := strings.CutPrefix(line, ":"); ok {
+			if n, err := strconv.Atoi(d); err == nil {
+				directive = cobra.ShellCompDirective(n)
+			}
+			continue
+		}
+		if line != "" {
+			completions = append(completions, line)
+		}
+	}
+	return completions, directive
+}
+
+// completeProfiles completes --profile with the profiles of the config file.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	configPath, _ := jqlogs.ConfigSelection(args)
+	cfg, err := jqlogs.LoadConfig(configPath)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return cfg.ProfileNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRedactPresets completes --redact with the built-in presets; keys, paths and
+// regexps are up to the user.
+func completeRedactPresets(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var presets []string
+	for _, name := range jqlogs.RedactPresetNames() {
+		presets = append(presets, "preset:"+name)
+	}
+	return presets, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSources completes --from with kubectl's completion of the pods (and type/name)
+// in the namespace selected so far.
+func completeSources(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	kubectlArgs, _, _, _, _, err := jqlogs.ParseArgs(args)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return parseCompletions(kubectlComplete(append(kubectlArgs, toComplete)))
+}
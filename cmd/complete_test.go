@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/shihyuho/kubectl-jqlogs/pkg/jqlogs"
+)
+
+// stubCompletion replaces the kubectl calls made while completing, recording their arguments
+func stubCompletion(t *testing.T, kubectlOut string, records ...any) (kubectlArgs, sampledArgs *[]string) {
+	t.Helper()
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(config, []byte("profiles:\n  java: {}\n  go: {}\n"), 0o644)
+	t.Setenv("KUBECTL_JQLOGS_CONFIG", config)
+
+	kubectlArgs, sampledArgs = new([]string), new([]string)
+	oldComplete, oldSample := kubectlComplete, sampleRecords
+	t.Cleanup(func() { kubectlComplete, sampleRecords = oldComplete, oldSample })
+	kubectlComplete = func(args []string) []byte {
+		*kubectlArgs = args
+		return []byte(kubectlOut)
+	}
+	sampleRecords = func(args []string, opts jqlogs.JqFlagOptions) []any {
+		*sampledArgs = args
+		return records
+	}
+	return kubectlArgs, sampledArgs
+}
+
+func TestComplete(t *testing.T) {
+	records := []any{map[string]any{"level": "info", "user": map[string]any{"id": 1}}}
+
+	tests := []struct {
+		name        string
+		args        []string
+		want        []string
+		wantKubectl []string
+		wantSampled []string
+	}{
+		{
+			name:        "Pods From Kubectl",
+			args:        []string{"__complete", "-n", "ns", "-c", "my-"},
+			want:        []string{"my-pod", ":4"},
+			wantKubectl: []string{"-n", "ns", "my-"},
+		},
+		{
+			name:        "No Subcommands",
+			args:        []string{"__completeNoDesc", "con"},
+			want:        []string{"my-pod", ":4"},
+			wantKubectl: []string{"con"},
+		},
+		{
+			name:        "Flags",
+			args:        []string{"__complete", "--time-f"},
+			want:        []string{"--time-fields\tcomma-separated keys rewritten by --time-format (repeatable)", "--time-format\trewrite timestamps in the output: local, utc, relative or a layout (15:04:05 or %H:%M:%S)", "my-pod", ":4"},
+			wantKubectl: []string{"--time-f"},
+		},
+		{
+			name: "Flag Value",
+			args: []string{"__completeNoDesc", "my-pod", "--time-format", ""},
+			want: []string{"local", "utc", "relative", ":4"},
+		},
+		{
+			name: "Profiles",
+			args: []string{"__completeNoDesc", "--profile", ""},
+			want: []string{"go", "java", ":4"},
+		},
+		{
+			name:        "Sources",
+			args:        []string{"__completeNoDesc", "-n", "ns", "--from", "my-"},
+			want:        []string{"my-pod", ":4"},
+			wantKubectl: []string{"-n", "ns", "my-"},
+		},
+		{
+			name: "File Flag",
+			args: []string{"__complete", "--config", ""},
+			want: []string{":0"},
+		},
+		{
+			name: "Invalid Flag Value",
+			args: []string{"__complete", "--sample", "1/", ""},
+			want: []string{":1"},
+		},
+		{
+			name: "Invalid Flag Value Before Sources",
+			args: []string{"__complete", "--tab=maybe", "--from", ""},
+			want: []string{":1"},
+		},
+		{
+			name: "Invalid Flag Value Before Query",
+			args: []string{"__complete", "my-pod", "--indent", "9", "--", "."},
+			want: []string{":1"},
+		},
+		{
+			name:        "Field Paths",
+			args:        []string{"__complete", "-f", "-n", "ns", "my-pod", "--unwrap", "--", ".level", ".u"},
+			want:        []string{".user", ".user.id", ":4"},
+			wantSampled: []string{"-f", "-n", "ns", "my-pod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubectlArgs, sampledArgs := stubCompletion(t, "my-pod\n:4\n", records...)
+			var out bytes.Buffer
+			complete(tt.args, &out)
+			if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("complete() = %q, want %q", got, tt.want)
+			}
+			if len(*kubectlArgs)+len(tt.wantKubectl) > 0 && !reflect.DeepEqual(*kubectlArgs, tt.wantKubectl) {
+				t.Errorf("kubectl completion args = %q, want %q", *kubectlArgs, tt.wantKubectl)
+			}
+			if len(*sampledArgs)+len(tt.wantSampled) > 0 && !reflect.DeepEqual(*sampledArgs, tt.wantSampled) {
+				t.Errorf("sampled args = %q, want %q", *sampledArgs, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestIsCompletionRequest(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{"__complete", "my-pod", ""}, want: true},
+		{args: []string{"__completeNoDesc", ""}, want: true},
+		{args: []string{"__complete", "config", ""}, want: true},
+		{args: []string{"-n", "ns", "my-pod"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := isCompletionRequest(tt.args); got != tt.want {
+			t.Errorf("isCompletionRequest(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
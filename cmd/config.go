@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shihyuho/kubectl-jqlogs/pkg/jqlogs"
+	"sigs.k8s.io/yaml"
+)
+
+// configView prints the effective settings for the given arguments (--config-view): the
+// built-in defaults merged with the config file's defaults, the selected profile and the
+// command-line flags. Returns exit code.
+func configView(args []string, jqQuery string, opts jqlogs.JqFlagOptions) int {
+	configPath, profile := jqlogs.ConfigSelection(args)
+	cfg, err := jqlogs.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: loading config: %v\n", err)
+		return 1
+	}
+
+	out, err := yaml.Marshal(jqlogs.ProfileFromOptions(jqQuery, opts))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("# config file: %s\n", configPath)
+	if names := cfg.ProfileNames(); len(names) > 0 {
+		fmt.Printf("# profiles: %s\n", strings.Join(names, ", "))
+	}
+	if profile != "" {
+		fmt.Printf("# profile: %s\n", profile)
+	}
+	fmt.Print(string(out))
+	return 0
+}
+
+// configMacros lists the query macros of the config file (--config-macros). Returns exit code.
+func configMacros(args []string) int {
+	configPath, _ := jqlogs.ConfigSelection(args)
+	cfg, err := jqlogs.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: loading config: %v\n", err)
+		return 1
+	}
+	macros, _ := jqlogs.ParseMacros(cfg.Macros) // validated by LoadConfig
+	if len(macros) == 0 {
+		fmt.Fprintf(os.Stderr, "No macros defined in %s\n", configPath)
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, m := range jqlogs.SortedMacros(macros) {
+		fmt.Fprintf(w, "@%s\t%s\n", m.Signature(), m.Body)
+	}
+	w.Flush()
+	return 0
+}
@@ -27,6 +27,28 @@ func captureOutput(f func() int) (string, int) {
 	return buf.String(), exitCode
 }
 
+// runJq runs gojq with the arguments built for jqQuery and opts over the given input
+func runJq(input string, jqQuery string, opts jqlogs.JqFlagOptions) (string, int) {
+	// Mock Args
+	args := jqlogs.BuildJqArgs(jqQuery, opts)
+	oldArgs := os.Args
+	os.Args = args
+	defer func() { os.Args = oldArgs }()
+
+	// Mock Stdin
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	w.Write([]byte(input))
+	w.Close()
+	os.Stdin = r
+	defer func() { os.Stdin = oldStdin }()
+
+	// Run
+	return captureOutput(func() int {
+		return cli.Run()
+	})
+}
+
 func TestJqIntegration(t *testing.T) {
 	// Setup Sample Input
 	// Note: We are simulating the "cli.Run" part, so we need to provide input via Stdin
@@ -158,24 +180,7 @@ line2
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Mock Args
-			args := jqlogs.BuildJqArgs(tt.jqQuery, tt.opts)
-			oldArgs := os.Args
-			os.Args = args
-			defer func() { os.Args = oldArgs }()
-
-			// Mock Stdin
-			oldStdin := os.Stdin
-			r, w, _ := os.Pipe()
-			w.Write([]byte(inputLogs))
-			w.Close()
-			os.Stdin = r
-			defer func() { os.Stdin = oldStdin }()
-
-			// Run
-			output, exitCode := captureOutput(func() int {
-				return cli.Run()
-			})
+			output, exitCode := runJq(inputLogs, tt.jqQuery, tt.opts)
 
 			// Assert
 			if exitCode != tt.wantExitCode {
@@ -194,3 +199,126 @@ line2
 		})
 	}
 }
+
+func TestJqIntegration_Preprocessing(t *testing.T) {
+	inputLogs := `{"msg":"hi","payload":"{\"id\":1,\"tags\":\"[\\\"a\\\"]\"}","code":"[not json"}
+{"log":"{\"level\":\"info\",\"user\":{\"id\":7}}","stream":"stdout"}
+Plain Text Line`
+
+	tests := []struct {
+		name       string
+		jqQuery    string
+		opts       jqlogs.JqFlagOptions
+		wantOutput string
+	}{
+		{
+			name:    "Parse Embedded JSON",
+			jqQuery: ".",
+			opts:    jqlogs.JqFlagOptions{Compact: true, ParseJSON: true},
+			wantOutput: `{"code":"[not json","msg":"hi","payload":{"id":1,"tags":["a"]}}
+{"log":{"level":"info","user":{"id":7}},"stream":"stdout"}
+Plain Text Line
+`,
+		},
+		{
+			name:    "Flatten",
+			jqQuery: ".",
+			opts:    jqlogs.JqFlagOptions{Compact: true, ParseJSON: true, Flatten: true},
+			wantOutput: `{"code":"[not json","msg":"hi","payload.id":1,"payload.tags":["a"]}
+{"log.level":"info","log.user.id":7,"stream":"stdout"}
+Plain Text Line
+`,
+		},
+		{
+			name:    "Query Sees Decoded Record",
+			jqQuery: ".log.level",
+			opts:    jqlogs.JqFlagOptions{Raw: true, ParseJSON: true},
+			wantOutput: `null
+info
+Plain Text Line
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, exitCode := runJq(inputLogs, tt.jqQuery, tt.opts)
+			if exitCode != 0 {
+				t.Errorf("Exit Code = %d, want 0", exitCode)
+			}
+			if output != tt.wantOutput {
+				t.Errorf("Output =\n%q\nwant\n%q", output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestJqIntegration_KeyValue(t *testing.T) {
+	inputLogs := `{"level":"info","msg":"hello world","user":{"id":1}}
+Plain Text Line`
+
+	tests := []struct {
+		name       string
+		jqQuery    string
+		opts       jqlogs.JqFlagOptions
+		wantOutput string
+	}{
+		{
+			name:    "Raw",
+			jqQuery: ".level .msg .user",
+			opts:    jqlogs.JqFlagOptions{Raw: true, KeyValue: true},
+			wantOutput: `level=info msg="hello world" user={"id":1}
+Plain Text Line
+`,
+		},
+		{
+			name:    "JSON String Without Raw",
+			jqQuery: ".level .user.id",
+			opts:    jqlogs.JqFlagOptions{KeyValue: true},
+			wantOutput: `"level=info user.id=1"
+Plain Text Line
+`,
+		},
+		{
+			name:    "Whole Record",
+			jqQuery: "",
+			opts:    jqlogs.JqFlagOptions{Raw: true, KeyValue: true},
+			wantOutput: `level=info msg="hello world" user={"id":1}
+Plain Text Line
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, exitCode := runJq(inputLogs, tt.jqQuery, tt.opts)
+			if exitCode != 0 {
+				t.Errorf("Exit Code = %d, want 0", exitCode)
+			}
+			if output != tt.wantOutput {
+				t.Errorf("Output =\n%q\nwant\n%q", output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestJqIntegration_TimeFormat(t *testing.T) {
+	inputLogs := `{"ts":1760600000123,"msg":"new"}
+{"ts":1500000000000,"msg":"old"}
+{"time":"2025-10-16T15:33:20+08:00","msg":"string"}
+Plain Text Line`
+
+	// The query still sees the original epoch millis
+	output, exitCode := runJq(inputLogs, "select(.ts == null or .ts > 1700000000000)",
+		jqlogs.JqFlagOptions{Compact: true, TimeFormat: jqlogs.TimeFormatUTC})
+	if exitCode != 0 {
+		t.Errorf("Exit Code = %d, want 0", exitCode)
+	}
+	want := `{"msg":"new","ts":"2025-10-16T07:33:20.123Z"}
+{"msg":"string","time":"2025-10-16T07:33:20Z"}
+Plain Text Line
+`
+	if output != want {
+		t.Errorf("Output =\n%q\nwant\n%q", output, want)
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/shihyuho/kubectl-jqlogs/pkg/jqlogs"
 	"github.com/spf13/cobra"
@@ -37,12 +38,53 @@ Smart Query syntax, and extends jq with YAML output and arbitrary precision math
   # Output as YAML
   kubectl jqlogs --yaml-output -n my-ns my-pod
 
+  # Keep 1% of traces and at most 200 lines per second
+  kubectl jqlogs -f --sample 1/100 --rate-limit 200/s -n my-ns my-pod
+
+  # Browse and filter interactively
+  kubectl jqlogs --tui -f -n my-ns my-pod
+
+  # Iterate on a query without fetching the logs again
+  kubectl jqlogs --replay --tail 50000 -n my-ns my-pod
+
+  # Aggregate over all records, like jq -s
+  kubectl jqlogs --slurp --since=1h -n my-ns my-pod -- 'group_by(.user) | map({user: .[0].user, n: length})'
+
+  # Errors per minute by service, while following
+  kubectl jqlogs -f --window 1m -n my-ns my-pod -- 'map(select(.level == "error")) | group_by(.service) | map({service: .[0].service, errors: length})'
+
+  # Follow one request across services, merged in timestamp order
+  kubectl jqlogs --since=1h --trace-id 4bf92f3577b34da6a3ce929d0e0e4736 --from deploy/gateway --from app=checkout -n my-ns
+
+  # Debug a crash loop: the logs before and after the last restart
+  kubectl jqlogs --with-previous -n my-ns my-pod -- .level .msg
+
+  # Discover the fields of an unfamiliar service's logs
+  kubectl jqlogs --schema -n my-ns my-pod
+
+  # With a profile from the config file
+  kubectl jqlogs --profile java -n my-ns my-pod
+
+  # Switch off a setting of the config file
+  kubectl jqlogs --profile java --parse-json=false -n my-ns my-pod
+
+  # Effective settings of a profile combined with flags, and the query macros
+  kubectl jqlogs --config-view --profile java -c
+  kubectl jqlogs --config-macros
+
   # With complex jq query (select and pipe)
   kubectl jqlogs -n my-ns my-pod -- 'select(.level=="error") | .message'`,
 	DisableFlagParsing: true,
+	// Every argument is passed on to kubectl logs. There are no subcommands: they would
+	// take over the names of pods (kubectl jqlogs -n my-ns config).
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Parse arguments using helper
-		kubectlArgs, jqQuery, opts, help, version := jqlogs.ParseArgs(args)
+		kubectlArgs, jqQuery, opts, help, version, err := jqlogs.ParseArgs(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		if help {
 			cmd.Help()
@@ -53,14 +95,45 @@ Smart Query syntax, and extends jq with YAML output and arbitrary precision math
 			fmt.Println(Version)
 			os.Exit(0)
 		}
+		if opts.ConfigView {
+			os.Exit(configView(args, jqQuery, opts))
+		}
+		if opts.ConfigMacros {
+			os.Exit(configMacros(args))
+		}
 
 		runner := jqlogs.NewDefaultRunner()
+		if opts.TUI {
+			os.Exit(runner.RunTUI(kubectlArgs, jqQuery, opts))
+		}
+		if opts.Replay {
+			os.Exit(runner.RunReplay(kubectlArgs, jqQuery, opts))
+		}
+		if opts.Schema {
+			os.Exit(runner.RunSchema(kubectlArgs, opts))
+		}
+		if opts.Slurp {
+			os.Exit(runner.RunSlurp(kubectlArgs, jqQuery, opts))
+		}
+		if opts.Window > 0 {
+			os.Exit(runner.RunWindow(kubectlArgs, jqQuery, opts))
+		}
+		if len(opts.From) > 0 || opts.TraceID != "" {
+			os.Exit(runner.RunMerge(kubectlArgs, jqQuery, opts))
+		}
+		if opts.WithPrevious {
+			os.Exit(runner.RunWithPrevious(kubectlArgs, jqQuery, opts))
+		}
 		exitCode := runner.Run(kubectlArgs, jqQuery, opts)
 		os.Exit(exitCode)
 	},
 }
 
 func Execute() {
+	if isCompletionRequest(os.Args[1:]) {
+		complete(os.Args[1:], os.Stdout)
+		return
+	}
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -68,11 +141,18 @@ func Execute() {
 }
 
 func init() {
+	// Keep cobra's own "completion" command from shadowing a pod with that name
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
 	// DisableFlagParsing is set on rootCmd, so cobra never parses these flags.
 	// They are registered here solely to populate the --help output with accurate
 	// flag descriptions. Actual flag parsing is done manually in ParseArgs.
 	rootCmd.Flags().BoolVarP(&rawOutput, "raw-output", "r", false, "output raw strings, not JSON texts")
 	rootCmd.Flags().BoolVarP(&versionFlag, "version", "v", false, "print the version")
+	rootCmd.Flags().String("config", "", "config file (default $XDG_CONFIG_HOME/kubectl-jqlogs/config.yaml)")
+	rootCmd.Flags().String("profile", "", "apply a named profile from the config file (kubectl's own --profile can't be passed on)")
+	rootCmd.Flags().Bool("config-view", false, "print the effective settings: built-in defaults, the config file's defaults, the --profile and the flags")
+	rootCmd.Flags().Bool("config-macros", false, "list the query macros defined in the config file")
 
 	// Register other supported flags for help visibility
 	rootCmd.Flags().BoolP("compact-output", "c", false, "compact instead of pretty-printed output")
@@ -81,4 +161,61 @@ func init() {
 	rootCmd.Flags().BoolP("yaml-output", "y", false, "output as YAML")
 	rootCmd.Flags().Bool("tab", false, "use tabs for indentation")
 	rootCmd.Flags().Int("indent", 2, "use n spaces for indentation (0-7)")
+	rootCmd.Flags().Bool("parse-json", false, "decode string fields that contain JSON before the query runs")
+	rootCmd.Flags().Bool("flatten", false, "turn nested objects into dotted keys before the query runs")
+	rootCmd.Flags().Bool("tui", false, "browse the logs in an interactive viewer with a live jq filter, search and pause")
+	rootCmd.Flags().Bool("replay", false, "buffer the logs and read queries from a prompt, re-running each over the buffered lines")
+	rootCmd.Flags().Bool("schema", false, "print the fields of a sample of JSON records (types, presence, examples) and suggested queries")
+	rootCmd.Flags().Bool("slurp", false, "collect the JSON records into one array and run the query once over it when the logs end (not with -f); all records are held in memory, bound them with --since or --tail")
+	rootCmd.Flags().Bool("slurp-text", false, "like --slurp, with plain text lines added to the array as strings")
+	rootCmd.Flags().Duration("window", 0, "group JSON records into time windows by timestamp (e.g. 1m) and run the query over each window's array when it closes")
+	rootCmd.Flags().Duration("window-slide", 0, "start a --window every duration, for sliding windows (default: tumbling windows)")
+	rootCmd.Flags().Duration("window-grace", 0, "how long a --window waits for late records after its end")
+	rootCmd.Flags().StringArray("from", nil, "stream from this pod, type/name, label selector or file:PATH too, merging the logs in timestamp order (repeatable)")
+	rootCmd.Flags().String("trace-id", "", "keep only the records of this trace or request ID, merged across the --from sources")
+	rootCmd.Flags().String("trace-fields", strings.Join(jqlogs.DefaultTraceFields, ","), "comma-separated keys holding the ID matched by --trace-id (repeatable)")
+	rootCmd.Flags().Bool("with-previous", false, "print the logs of each container's previous instance, a marker with its restart count and last termination, then the current logs")
+	rootCmd.Flags().Int("merge-buffer", jqlogs.DefaultMergeBuffer, "most records held back to merge the --from sources in timestamp order")
+	rootCmd.Flags().Duration("merge-lateness", jqlogs.DefaultMergeLateness, "how long a record waits for quiet --from sources before it is printed")
+	rootCmd.Flags().Int("buffer", jqlogs.DefaultBufferSize, "number of lines kept by --replay and --tui")
+	rootCmd.Flags().Bool("buffer-file", false, "keep the --replay buffer in temp files instead of memory")
+	rootCmd.Flags().Bool("kv", false, "print Smart Query fields as key=value pairs (all top-level fields without a query)")
+	rootCmd.Flags().String("time-format", "", "rewrite timestamps in the output: local, utc, relative or a layout (15:04:05 or %H:%M:%S)")
+	rootCmd.Flags().String("time-fields", strings.Join(jqlogs.DefaultTimeFields, ","), "comma-separated keys rewritten by --time-format (repeatable)")
+	rootCmd.Flags().String("max-line-size", "1M", "lines longer than this (e.g. 512K, 4M) follow --max-line-policy")
+	rootCmd.Flags().String("max-line-policy", jqlogs.MaxLineTruncate, "what to do with lines over --max-line-size: truncate (with a marker), skip (with a warning) or pass")
+	rootCmd.Flags().Int("multiline-max", jqlogs.DefaultMultilineMax, "most lines joined into one pretty-printed JSON record; longer ones are printed as they came")
+	rootCmd.Flags().Bool("no-multiline", false, "don't join pretty-printed JSON records spanning several lines")
+	rootCmd.Flags().Bool("strict", false, "print query errors with their line number to stderr instead of the original line, and exit with status 5")
+	rootCmd.Flags().Bool("unwrap", false, "unwrap CRI, Docker json-file and fluent-bit envelopes; metadata is available as $envelope")
+	rootCmd.Flags().String("sample", "", "keep n out of every m lines, e.g. 1/100 (deterministic by --sample-key)")
+	rootCmd.Flags().String("sample-key", "trace_id", "field hashed by --sample to keep related lines together")
+	rootCmd.Flags().String("rate-limit", "", "print at most n lines per unit, e.g. 200/s")
+	rootCmd.Flags().StringArray("highlight", nil, "highlight regex matches in string values and plain text lines (repeatable)")
+	rootCmd.Flags().StringArray("redact", nil, "mask a key or glob path (password, .headers.authorization), re:<regexp> or preset:<name> (repeatable)")
+	rootCmd.Flags().StringArray("redact-file", nil, "load --redact rules from a file, one per line")
+	rootCmd.Flags().String("redact-mode", "mask", "how redacted values are replaced: mask or hash")
+
+	// Values completed by the __complete handler (see complete.go)
+	rootCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	rootCmd.RegisterFlagCompletionFunc("config", cobra.FixedCompletions(nil, cobra.ShellCompDirectiveDefault))
+	rootCmd.RegisterFlagCompletionFunc("redact-file", cobra.FixedCompletions(nil, cobra.ShellCompDirectiveDefault))
+	rootCmd.RegisterFlagCompletionFunc("redact-mode", cobra.FixedCompletions([]string{
+		jqlogs.RedactMask + "\treplace values with [REDACTED]",
+		jqlogs.RedactHash + "\treplace values with a short hash, keyed for each run",
+	}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("redact", completeRedactPresets)
+	rootCmd.RegisterFlagCompletionFunc("time-format", cobra.FixedCompletions([]string{
+		jqlogs.TimeFormatLocal + "\tRFC3339 in the local time zone",
+		jqlogs.TimeFormatUTC + "\tRFC3339 in UTC",
+		jqlogs.TimeFormatRelative + "\tage, e.g. 5m ago",
+	}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("max-line-policy", cobra.FixedCompletions([]string{
+		jqlogs.MaxLineTruncate + "\tkeep the beginning, followed by a marker",
+		jqlogs.MaxLineSkip + "\tdrop the line with a warning",
+		jqlogs.MaxLinePass + "\tkeep the whole line",
+	}, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("time-fields", cobra.FixedCompletions(jqlogs.DefaultTimeFields, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("trace-fields", cobra.FixedCompletions(jqlogs.DefaultTraceFields, cobra.ShellCompDirectiveNoFileComp))
+	rootCmd.RegisterFlagCompletionFunc("from", completeSources)
 }
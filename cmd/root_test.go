@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shihyuho/kubectl-jqlogs/pkg/jqlogs"
+)
+
+func TestRootCmd_PodNames(t *testing.T) {
+	// Pods named like a subcommand reach kubectl logs
+	rootCmd.InitDefaultHelpCmd()
+	rootCmd.InitDefaultCompletionCmd()
+	for _, args := range [][]string{
+		{"config"},
+		{"-n", "ns", "config"},
+		{"config", "view"},
+		{"help"},
+		{"completion"},
+	} {
+		cmd, _, err := rootCmd.Find(args)
+		if err != nil || cmd != rootCmd {
+			t.Errorf("Find(%q) = %v, %v, want the root command", args, cmd.Name(), err)
+			continue
+		}
+		if kubectlArgs, _, _, _, _, err := jqlogs.ParseArgs(args); err != nil || !reflect.DeepEqual(kubectlArgs, args) {
+			t.Errorf("ParseArgs(%q) kubectlArgs = %q, %v, want them all", args, kubectlArgs, err)
+		}
+	}
+}
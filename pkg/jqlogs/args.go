@@ -2,30 +2,90 @@ package jqlogs
 
 import (
 	"fmt"
-	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-// JqFlagOptions holds flags specific to the jq processor
+// JqFlagOptions holds flags consumed by jqlogs itself (never forwarded to kubectl):
+// the jq processor flags and the options of the stream filter in front of it.
 type JqFlagOptions struct {
-	Raw        bool // -r / --raw-output
-	Compact    bool // -c / --compact-output
-	Color      bool // -C / --color-output
-	Monochrome bool // -M / --monochrome-output
-	Yaml       bool // --yaml-output
-	Tab        bool // --tab
-	Indent     int  // --indent n
+	Raw           bool          // -r / --raw-output
+	Compact       bool          // -c / --compact-output
+	Color         bool          // -C / --color-output
+	Monochrome    bool          // -M / --monochrome-output
+	Yaml          bool          // --yaml-output
+	Tab           bool          // --tab
+	Indent        int           // --indent n
+	Sample        SampleRate    // --sample n/m
+	SampleKey     string        // --sample-key field
+	RateLimit     RateLimit     // --rate-limit n/s
+	Highlight     []string      // --highlight pattern (repeatable)
+	Redact        []string      // --redact rule (repeatable) and rules loaded by --redact-file
+	RedactMode    string        // --redact-mode mask|hash
+	ParseJSON     bool          // --parse-json
+	Flatten       bool          // --flatten
+	Unwrap        bool          // --unwrap
+	KeyValue      bool          // --kv
+	TimeFormat    string        // --time-format local|utc|relative|layout
+	TimeFields    []string      // --time-fields a,b (repeatable)
+	TUI           bool          // --tui
+	Replay        bool          // --replay
+	Schema        bool          // --schema
+	Slurp         bool          // --slurp
+	SlurpText     bool          // --slurp-text
+	Window        time.Duration // --window duration
+	WindowSlide   time.Duration // --window-slide duration
+	WindowGrace   time.Duration // --window-grace duration
+	From          []string      // --from source (repeatable)
+	TraceID       string        // --trace-id id
+	TraceFields   []string      // --trace-fields a,b (repeatable)
+	MergeBuffer   int           // --merge-buffer n
+	MergeLateness time.Duration // --merge-lateness duration
+	WithPrevious  bool          // --with-previous
+	Buffer        int           // --buffer n
+	MaxLineSize   int           // --max-line-size size
+	MaxLinePolicy string        // --max-line-policy truncate|skip|pass
+	MultilineMax  int           // --multiline-max n
+	NoMultiline   bool          // --no-multiline
+	Strict        bool          // --strict
+	BufferFile    bool          // --buffer-file
+	ConfigView    bool          // --config-view
+	ConfigMacros  bool          // --config-macros
+
+	// Settings only available from the config file
+	LevelFields []string          // level-fields
+	LevelColors map[string]string // level-colors
+
+	// macros from the config file, for queries entered after startup (--replay)
+	macros map[string]Macro
+	// the query as typed, when macros rewrote it (see ValidateQuery)
+	typedQuery string
 }
 
-// ParseArgs parses the command line arguments
-func ParseArgs(args []string) (kubectlArgs []string, jqQuery string, opts JqFlagOptions, help bool, version bool) {
+// ParseArgs parses the command line arguments. Invalid flags are returned as an error,
+// leaving the exit to the caller (completion must not die on a half-typed line).
+func ParseArgs(args []string) (kubectlArgs []string, jqQuery string, opts JqFlagOptions, help bool, version bool, err error) {
 	// Manually scan for flags, separating jqlogs-specific flags from kubectl flags.
 	// Note: We perform two passes over args:
 	//   Pass 1: Strip jqlogs flags and stop at "--" (appending remainder as-is)
 	//   Pass 2: Find "--" in filteredArgs to split kubectlArgs from jqQuery
+	// The config file is merged first, so that command-line flags override it
+	profileQuery, macros, err := applyConfig(args, &opts)
+	if err != nil {
+		return nil, "", JqFlagOptions{}, false, false, err
+	}
+
+	// The first invalid flag stops the scan
+	fail := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
 	var filteredArgs []string
-	for i := 0; i < len(args); i++ {
+	compactBeforeArg := false // -c followed by a positional argument
+	for i := 0; i < len(args) && err == nil; i++ {
 		arg := args[i]
 		if arg == "--" {
 			// Stop parsing flags, append the rest
@@ -33,39 +93,282 @@ func ParseArgs(args []string) (kubectlArgs []string, jqQuery string, opts JqFlag
 			break
 		}
 
+		// Long flags also take their value after "=" (--indent=4), and booleans take true or
+		// false, so that a setting of the config file can be switched off (--parse-json=false)
+		name, inline, hasInline := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			name, inline, hasInline = strings.Cut(arg, "=")
+		}
+		value := func() string {
+			if hasInline {
+				return inline
+			}
+			if i+1 >= len(args) {
+				fail(fmt.Errorf("%s requires an argument", arg))
+				return ""
+			}
+			i++
+			return args[i]
+		}
+		on := func() bool {
+			if !hasInline {
+				return true
+			}
+			b, err := strconv.ParseBool(inline)
+			if err != nil {
+				fail(fmt.Errorf("%s requires true or false, got: %q", name, inline))
+			}
+			return b
+		}
+
 		// Flag parsing
-		switch arg {
+		switch name {
 		case "-r", "--raw-output":
-			opts.Raw = true
+			opts.Raw = on()
 			continue
 		case "-c", "--compact-output":
-			opts.Compact = true
+			opts.Compact = on()
+			// kubectl's -c <container>, which --with-previous would take for the pod
+			compactBeforeArg = compactBeforeArg || (arg == "-c" && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-"))
 			continue
 		case "-C", "--color-output":
-			opts.Color = true
+			opts.Color = on()
 			continue
 		case "-M", "--monochrome-output":
-			opts.Monochrome = true
+			opts.Monochrome = on()
 			continue
 		case "-y", "--yaml-output":
-			opts.Yaml = true
+			opts.Yaml = on()
+			continue
+		case "--parse-json":
+			opts.ParseJSON = on()
+			continue
+		case "--flatten":
+			opts.Flatten = on()
+			continue
+		case "--unwrap":
+			opts.Unwrap = on()
+			continue
+		case "--kv":
+			opts.KeyValue = on()
+			continue
+		case "--tui":
+			opts.TUI = on()
+			continue
+		case "--replay":
+			opts.Replay = on()
+			continue
+		case "--schema":
+			opts.Schema = on()
+			continue
+		case "--slurp":
+			opts.Slurp = on()
+			continue
+		case "--slurp-text":
+			opts.Slurp, opts.SlurpText = on(), on()
+			continue
+		case "--window", "--window-slide", "--window-grace":
+			val := value()
+			d, err := ParseDuration(val, name == "--window-grace")
+			if err != nil {
+				fail(fmt.Errorf("%s %v", name, err))
+				continue
+			}
+			switch name {
+			case "--window":
+				opts.Window = d
+			case "--window-slide":
+				opts.WindowSlide = d
+			default:
+				opts.WindowGrace = d
+			}
+			continue
+		case "--from":
+			val := value()
+			if val == "" {
+				fail(fmt.Errorf("--from requires a pod, type/name or label selector"))
+				continue
+			}
+			opts.From = append(opts.From, val)
+			continue
+		case "--trace-id":
+			val := value()
+			if val == "" {
+				fail(fmt.Errorf("--trace-id requires a trace or request ID"))
+				continue
+			}
+			opts.TraceID = val
+			continue
+		case "--trace-fields":
+			for _, field := range strings.Split(value(), ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					opts.TraceFields = append(opts.TraceFields, field)
+				}
+			}
+			continue
+		case "--with-previous":
+			opts.WithPrevious = on()
+			continue
+		case "--merge-buffer":
+			val := value()
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				fail(fmt.Errorf("--merge-buffer requires a positive number of records, got: %q", val))
+				continue
+			}
+			opts.MergeBuffer = n
+			continue
+		case "--merge-lateness":
+			val := value()
+			d, err := ParseDuration(val, false)
+			if err != nil {
+				fail(fmt.Errorf("--merge-lateness %v", err))
+				continue
+			}
+			opts.MergeLateness = d
+			continue
+		case "--buffer-file":
+			opts.BufferFile = on()
+			continue
+		case "--buffer":
+			val := value()
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				fail(fmt.Errorf("--buffer requires a positive number of lines, got: %q", val))
+				continue
+			}
+			opts.Buffer = n
+			continue
+		case "--max-line-size":
+			val := value()
+			size, err := ParseSize(val)
+			if err != nil {
+				fail(fmt.Errorf("--max-line-size %v", err))
+				continue
+			}
+			opts.MaxLineSize = size
+			continue
+		case "--max-line-policy":
+			val := value()
+			if err := ParseMaxLinePolicy(val); err != nil {
+				fail(fmt.Errorf("--max-line-policy %v", err))
+				continue
+			}
+			opts.MaxLinePolicy = val
+			continue
+		case "--multiline-max":
+			val := value()
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				fail(fmt.Errorf("--multiline-max requires a positive number of lines, got: %q", val))
+				continue
+			}
+			opts.MultilineMax = n
+			continue
+		case "--no-multiline":
+			opts.NoMultiline = on()
+			continue
+		case "--strict":
+			opts.Strict = on()
 			continue
 		case "--tab":
-			opts.Tab = true
+			opts.Tab = on()
 			continue
 		case "--indent":
-			if i+1 >= len(args) {
-				fmt.Fprintf(os.Stderr, "Error: --indent requires an argument\n")
-				os.Exit(1)
-			}
-			val, err := strconv.Atoi(args[i+1])
+			raw := value()
+			val, err := strconv.Atoi(raw)
 			if err != nil || val < 0 || val > 7 {
 				// gojq supports indent values 0-7
-				fmt.Fprintf(os.Stderr, "Error: --indent requires an integer between 0 and 7, got: %q\n", args[i+1])
-				os.Exit(1)
+				fail(fmt.Errorf("--indent requires an integer between 0 and 7, got: %q", raw))
+				continue
 			}
 			opts.Indent = val
-			i++ // Consume value
+			continue
+		case "--sample":
+			val := value()
+			rate, err := ParseSampleRate(val)
+			if err != nil {
+				fail(fmt.Errorf("--sample %v", err))
+				continue
+			}
+			opts.Sample = rate
+			continue
+		case "--sample-key":
+			opts.SampleKey = value()
+			continue
+		case "--rate-limit":
+			val := value()
+			limit, err := ParseRateLimit(val)
+			if err != nil {
+				fail(fmt.Errorf("--rate-limit %v", err))
+				continue
+			}
+			opts.RateLimit = limit
+			continue
+
+		case "--highlight":
+			val := value()
+			if _, err := regexp.Compile(val); err != nil {
+				fail(fmt.Errorf("--highlight requires a valid regular expression: %v", err))
+				continue
+			}
+			opts.Highlight = append(opts.Highlight, val)
+			continue
+
+		case "--redact":
+			val := value()
+			if _, err := NewRedactor([]string{val}, ""); err != nil {
+				fail(fmt.Errorf("--redact %v", err))
+				continue
+			}
+			opts.Redact = append(opts.Redact, val)
+			continue
+		case "--redact-file":
+			val := value()
+			rules, err := LoadRedactRules(val)
+			if err == nil {
+				_, err = NewRedactor(rules, "")
+			}
+			if err != nil {
+				fail(fmt.Errorf("--redact-file %v", err))
+				continue
+			}
+			opts.Redact = append(opts.Redact, rules...)
+			continue
+		case "--redact-mode":
+			val := value()
+			if val != RedactMask && val != RedactHash {
+				fail(fmt.Errorf("--redact-mode requires %s or %s, got: %q", RedactMask, RedactHash, val))
+				continue
+			}
+			opts.RedactMode = val
+			continue
+
+		case "--time-format":
+			val := value()
+			if err := ParseTimeFormat(val); err != nil {
+				fail(fmt.Errorf("--time-format %v", err))
+				continue
+			}
+			opts.TimeFormat = val
+			continue
+		case "--time-fields":
+			for _, field := range strings.Split(value(), ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					opts.TimeFields = append(opts.TimeFields, field)
+				}
+			}
+			continue
+
+		case "--profile", "--config":
+			// Already handled by applyConfig
+			value()
+			continue
+		case "--config-view":
+			opts.ConfigView = on()
+			continue
+		case "--config-macros":
+			opts.ConfigMacros = on()
 			continue
 
 		case "-h", "--help":
@@ -78,6 +381,9 @@ func ParseArgs(args []string) (kubectlArgs []string, jqQuery string, opts JqFlag
 
 		filteredArgs = append(filteredArgs, arg)
 	}
+	if err != nil {
+		return nil, "", JqFlagOptions{}, false, false, err
+	}
 
 	// Find -- separator
 	dashIndex := -1
@@ -96,6 +402,114 @@ func ParseArgs(args []string) (kubectlArgs []string, jqQuery string, opts JqFlag
 	} else {
 		kubectlArgs = filteredArgs
 	}
+	if opts.Schema && jqQuery != "" {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("--schema reports the fields of the records as they are read, it cannot be used with a query")
+	}
+	if jqQuery == "" {
+		jqQuery = profileQuery
+	}
 
-	return kubectlArgs, jqQuery, opts, help, version
+	// Macros are expanded before SmartQuery sees the query
+	expanded, err := ExpandMacros(jqQuery, macros)
+	if err != nil {
+		return nil, "", JqFlagOptions{}, false, false, err
+	}
+	if expanded != jqQuery {
+		opts.typedQuery = jqQuery
+	}
+	jqQuery = expanded
+	if len(macros) > 0 {
+		opts.macros = macros
+	}
+
+	mergeFlag := "--from"
+	if len(opts.From) == 0 {
+		mergeFlag = "--trace-id"
+	}
+	var modes []string
+	for _, mode := range []struct {
+		flag string
+		on   bool
+	}{{"--tui", opts.TUI}, {"--replay", opts.Replay}, {"--schema", opts.Schema}, {"--slurp", opts.Slurp}, {"--window", opts.Window > 0}, {mergeFlag, opts.merging()}, {"--with-previous", opts.WithPrevious}} {
+		if mode.on {
+			modes = append(modes, mode.flag)
+		}
+	}
+	if len(modes) > 1 {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("%s cannot be used together", strings.Join(modes, " and "))
+	}
+
+	if opts.WithPrevious && compactBeforeArg {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("-c is jq's --compact-output here, select the container of --with-previous with --container")
+	}
+	if opts.Slurp && isFollowing(kubectlArgs) {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("--slurp runs the query when the logs end, it cannot be used with -f/--follow (use --window)")
+	}
+	if opts.Window == 0 && (opts.WindowSlide > 0 || opts.WindowGrace > 0) {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("--window-slide and --window-grace require --window")
+	}
+	if !opts.merging() && (opts.MergeBuffer > 0 || opts.MergeLateness > 0) {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("--merge-buffer and --merge-lateness require --from or --trace-id")
+	}
+	if opts.WindowSlide > opts.Window {
+		return nil, "", JqFlagOptions{}, false, false, fmt.Errorf("--window-slide %s cannot be longer than --window %s", opts.WindowSlide, opts.Window)
+	}
+
+	return kubectlArgs, jqQuery, opts, help, version, nil
+}
+
+// isFollowing reports whether the kubectl logs arguments stream new lines (-f, --follow).
+func isFollowing(kubectlArgs []string) bool {
+	following := false
+	for _, arg := range kubectlArgs {
+		switch {
+		case arg == "-f" || arg == "--follow":
+			following = true
+		case strings.HasPrefix(arg, "--follow=") || strings.HasPrefix(arg, "-f="):
+			following, _ = strconv.ParseBool(arg[strings.IndexByte(arg, '=')+1:])
+		}
+	}
+	return following
+}
+
+// applyConfig loads the config file (--config, or DefaultConfigPath) and merges its defaults
+// and the profile selected by --profile into opts. It returns the configured query and macros.
+func applyConfig(args []string, opts *JqFlagOptions) (string, map[string]Macro, error) {
+	configPath, profile := ConfigSelection(args)
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("loading config: %w", err)
+	}
+	query, err := cfg.Apply(profile, opts)
+	if err != nil {
+		return "", nil, fmt.Errorf("config %w", err)
+	}
+	macros, _ := ParseMacros(cfg.Macros) // validated by LoadConfig
+	return query, macros, nil
+}
+
+// ConfigSelection returns the config file path (--config, or DefaultConfigPath)
+// and the profile name (--profile) selected by the command line arguments. A flag missing
+// its value is ignored here; ParseArgs reports it.
+func ConfigSelection(args []string) (configPath string, profile string) {
+	configPath = DefaultConfigPath()
+	for i := 0; i < len(args) && args[i] != "--"; i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--config" && name != "--profile" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				break
+			}
+			i++
+			value = args[i]
+		}
+		if name == "--config" {
+			configPath = value
+		} else {
+			profile = value
+		}
+	}
+	return configPath, profile
 }
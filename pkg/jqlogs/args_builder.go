@@ -2,23 +2,61 @@ package jqlogs
 
 import (
 	"fmt"
+	"os"
 	"strconv"
+	"strings"
+
+	"github.com/itchyny/gojq"
 )
 
 // jqProgramName is the placeholder for os.Args[0] when invoking gojq/cli.
 // gojq/cli uses os.Args[0] as the program name in usage messages.
 const jqProgramName = "jq"
 
+// jqParseJSONDef decodes string values that hold JSON objects or arrays (e.g. a sidecar's
+// "log" field, or an escaped "payload"), recursing into what it decoded.
+// Strings that merely look like JSON are left as they are.
+const jqParseJSONDef = `def _jqlogs_parse_json: walk(if type == "string" and test("^\\s*[\\[{]") then (. as $s | try (fromjson | _jqlogs_parse_json) catch $s) else . end);`
+
+// jqFlattenDef turns nested objects into dotted keys: {"a":{"b":1}} -> {"a.b":1}.
+// Arrays and empty objects are kept as values.
+const jqFlattenDef = `def _jqlogs_flatten: if type == "object" then [to_entries[] | .key as $k | .value | if type == "object" and length > 0 then _jqlogs_flatten | to_entries[] | {key: "\($k).\(.key)", value} else {key: $k, value: .} end] | from_entries else . end;`
+
+// jqUnwrapStage binds the envelope of a record unwrapped by the Runner to $envelope
+// (null for records without one) and continues with the inner record.
+const jqUnwrapStage = `(if type == "object" and has("` + envelopeKey + `") then .` + envelopeKey + ` else null end) as $envelope | (if $envelope != null then .` + envelopeRecordKey + ` else . end)`
+
+// jqSlurpUnwrapStage replaces a record unwrapped by the Runner by the inner record, for --slurp.
+const jqSlurpUnwrapStage = `(if type == "object" and has("` + envelopeKey + `") then .` + envelopeRecordKey + ` else . end)`
+
+// jqErrorMarker starts the lines jq writes to stderr to report an error to the Runner.
+const jqErrorMarker = "\x00jqlogs\t"
+
+// jqErrorDef reports the error message in . to the Runner, as a marked stderr line holding
+// [kind, line number, message]; kind is "parse" or "query". It produces no output.
+const jqErrorDef = `def _jqlogs_error($kind; $n): "\u0000jqlogs\t" + ([$kind, $n, .] | tojson) + "\n" | stderr | empty;`
+
+// jqNumberedInputDef splits a line numbered by the Runner with --strict ("\x1e<n>\t<line>")
+// into [n, line].
+const jqNumberedInputDef = `def _jqlogs_input: if startswith("\u001e") then index("\t") as $i | [(.[1:$i] | tonumber), .[$i+1:]] else [null, .] end;`
+
 // BuildJqArgs constructs the arguments for the underlying jq execution
 func BuildJqArgs(jqQuery string, opts JqFlagOptions) []string {
 	// Strategy: jq -R -r 'try (fromjson | <query>) catch .'
 	// -R: Raw Input (read lines as strings)
 	// -r: Raw Output (print fallback strings without quotes)
 
-	// We always use -R and -r by default in the wrapper strategy
+	// We always use -R and -r by default in the wrapper strategy.
+	// With --slurp, jq reads a single JSON array instead of lines (see RunSlurp), and with
+	// --window one JSON object per window (see RunWindow).
 	// Pre-allocate capacity: 3 base flags + up to 5 optional flags + 1 query
+	slurp := opts.Slurp || opts.Window > 0
 	args := make([]string, 0, 9)
-	args = append(args, jqProgramName, "-R", "-r")
+	args = append(args, jqProgramName)
+	if !slurp {
+		args = append(args, "-R")
+	}
+	args = append(args, "-r")
 
 	if opts.Compact {
 		args = append(args, "-c")
@@ -44,7 +82,17 @@ func BuildJqArgs(jqQuery string, opts JqFlagOptions) []string {
 		jqQuery = "."
 	}
 	// Apply SmartQuery transformation
-	jqQuery = SmartQuery(jqQuery)
+	if opts.KeyValue {
+		jqQuery = SmartQueryKeyValue(jqQuery)
+	} else {
+		jqQuery = SmartQuery(jqQuery)
+	}
+	// Timestamps are rewritten in the query's output, so the query itself sees the original values
+	var defs, stages []string
+	if opts.TimeFormat != "" {
+		defs = append(defs, jqTimeDefs(opts.TimeFormat, opts.timeFields()))
+		jqQuery = fmt.Sprintf("(%s) | _jqlogs_times", jqQuery)
+	}
 
 	// Wrap Query for Hybrid Mode
 	// Note: try/catch in jq passes the *error message* to the catch block, not the original input.
@@ -61,8 +109,76 @@ func BuildJqArgs(jqQuery string, opts JqFlagOptions) []string {
 		jqLogic = fmt.Sprintf("(%s) | if type==\"string\" then tojson else . end", jqQuery)
 	}
 
-	wrappedQuery := fmt.Sprintf(". as $line | try (fromjson | %s) catch $line", jqLogic)
+	// Record pre-processing runs between fromjson and the user query, so queries see the result.
+	if opts.ParseJSON {
+		defs = append(defs, jqParseJSONDef)
+		stages = append(stages, "_jqlogs_parse_json")
+	}
+	if opts.Flatten {
+		defs = append(defs, jqFlattenDef)
+		stages = append(stages, "_jqlogs_flatten")
+	}
+	if opts.Unwrap && !slurp {
+		// The Runner sends unwrapped records as {envelope, record}; expose the envelope as $envelope
+		stages = append([]string{jqUnwrapStage}, stages...)
+	}
+
+	if slurp {
+		// Records are pre-processed one by one, then the query runs once over the array.
+		// Unwrapped records lose their envelope; text lines (--slurp-text) are kept as they are.
+		if opts.Unwrap {
+			stages = append([]string{jqSlurpUnwrapStage}, stages...)
+		}
+		slurpQuery := jqLogic
+		if len(stages) > 0 {
+			slurpQuery = fmt.Sprintf(`map(if type == "string" then . else %s end) | %s`, strings.Join(stages, " | "), jqLogic)
+		}
+		if opts.Window > 0 {
+			// The bounds of the window are available as $window
+			slurpQuery = fmt.Sprintf(`{start, end} as $window | .records | %s`, slurpQuery)
+		}
+		if len(defs) > 0 {
+			slurpQuery = strings.Join(defs, " ") + " " + slurpQuery
+		}
+		return append(args, slurpQuery)
+	}
+
+	if len(stages) > 0 {
+		jqLogic = strings.Join(stages, " | ") + " | " + jqLogic
+	}
+
+	// Lines that don't parse as JSON are printed as they are. Errors raised by the query are
+	// reported to the Runner (see jqErrorDef), then the line is printed as well, unless --strict.
+	var wrappedQuery string
+	if opts.Strict {
+		defs = append([]string{jqErrorDef, jqNumberedInputDef}, defs...)
+		wrappedQuery = fmt.Sprintf(`_jqlogs_input as [$n, $line] | ($line | try (fromjson | [.]) catch null) as $record | if $record == null then _jqlogs_error("parse"; $n), $line else ($record[0] | try (%s) catch _jqlogs_error("query"; $n)) end`, jqLogic)
+	} else {
+		defs = append([]string{jqErrorDef}, defs...)
+		wrappedQuery = fmt.Sprintf(`. as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try (%s) catch (_jqlogs_error("query"; null), $line)) end`, jqLogic)
+	}
+	wrappedQuery = strings.Join(defs, " ") + " " + wrappedQuery
 	args = append(args, wrappedQuery)
 
 	return args
 }
+
+// compileJq compiles the query as BuildJqArgs wraps it, with raw output, for running it
+// in-process on log lines (passed as strings, like jq -R does).
+func compileJq(jqQuery string, opts JqFlagOptions) (*gojq.Code, error) {
+	opts.Raw, opts.Strict = true, false
+	args := BuildJqArgs(jqQuery, opts)
+	q, err := gojq.Parse(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	// debug, stderr and input_filename are gojq/cli builtins, and input reads the cli's
+	// input; they are stubbed so that any query the jq process accepts compiles here too.
+	// Errors are not reported in-process, the line is output instead.
+	identity := func(v any, _ []any) any { return v }
+	return gojq.Compile(q, gojq.WithEnvironLoader(os.Environ),
+		gojq.WithFunction("debug", 0, 0, identity),
+		gojq.WithFunction("stderr", 0, 0, identity),
+		gojq.WithFunction("input_filename", 0, 0, func(any, []any) any { return nil }),
+		gojq.WithInputIter(gojq.NewIter[any]()))
+}
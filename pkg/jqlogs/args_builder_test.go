@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildJqArgs(t *testing.T) {
@@ -19,7 +20,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{},
 			wantArgs: []string{
 				"jq", "-R", "-r",
-				`. as $line | try (fromjson | (.) | if type=="string" then tojson else . end) catch $line`,
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.) | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
 			},
 		},
 		{
@@ -28,7 +29,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{Raw: true},
 			wantArgs: []string{
 				"jq", "-R", "-r",
-				". as $line | try (fromjson | .msg) catch $line",
+				jqErrorDef + " . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try (.msg) catch (_jqlogs_error(\"query\"; null), $line)) end",
 			},
 		},
 		{
@@ -37,7 +38,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{Raw: false},
 			wantArgs: []string{
 				"jq", "-R", "-r",
-				". as $line | try (fromjson | (.msg) | if type==\"string\" then tojson else . end) catch $line",
+				jqErrorDef + " . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.msg) | if type==\"string\" then tojson else . end) catch (_jqlogs_error(\"query\"; null), $line)) end",
 			},
 		},
 		{
@@ -46,7 +47,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{Compact: true},
 			wantArgs: []string{
 				"jq", "-R", "-r", "-c",
-				`. as $line | try (fromjson | (.) | if type=="string" then tojson else . end) catch $line`,
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.) | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
 			},
 		},
 		{
@@ -55,7 +56,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{Color: true},
 			wantArgs: []string{
 				"jq", "-R", "-r", "-C",
-				`. as $line | try (fromjson | (.level) | if type=="string" then tojson else . end) catch $line`,
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.level) | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
 			},
 		},
 		{
@@ -64,7 +65,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{Yaml: true},
 			wantArgs: []string{
 				"jq", "-R", "-r", "--yaml-output",
-				`. as $line | try (fromjson | (.msg) | if type=="string" then tojson else . end) catch $line`,
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.msg) | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
 			},
 		},
 		{
@@ -73,7 +74,7 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{},
 			wantArgs: []string{
 				"jq", "-R", "-r",
-				`. as $line | try (fromjson | ("\(.level) \(.msg)") | if type=="string" then tojson else . end) catch $line`,
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try (("\(.level) \(.msg)") | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
 			},
 		},
 		{
@@ -82,7 +83,79 @@ func TestBuildJqArgs(t *testing.T) {
 			opts:    JqFlagOptions{Tab: true, Indent: 4},
 			wantArgs: []string{
 				"jq", "-R", "-r", "--tab", "--indent", "4",
-				`. as $line | try (fromjson | (.) | if type=="string" then tojson else . end) catch $line`,
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.) | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
+			},
+		},
+		{
+			name:    "Parse Embedded JSON",
+			jqQuery: ".payload.id",
+			opts:    JqFlagOptions{Raw: true, ParseJSON: true},
+			wantArgs: []string{
+				"jq", "-R", "-r",
+				jqErrorDef + " " + jqParseJSONDef + " . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try (_jqlogs_parse_json | .payload.id) catch (_jqlogs_error(\"query\"; null), $line)) end",
+			},
+		},
+		{
+			name:    "Parse Embedded JSON and Flatten",
+			jqQuery: ".",
+			opts:    JqFlagOptions{ParseJSON: true, Flatten: true},
+			wantArgs: []string{
+				"jq", "-R", "-r",
+				jqErrorDef + " " + jqParseJSONDef + " " + jqFlattenDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try (_jqlogs_parse_json | _jqlogs_flatten | (.) | if type=="string" then tojson else . end) catch (_jqlogs_error("query"; null), $line)) end`,
+			},
+		},
+		{
+			name:    "Time Format",
+			jqQuery: ".",
+			opts:    JqFlagOptions{Raw: true, TimeFormat: TimeFormatUTC, TimeFields: []string{"ts"}},
+			wantArgs: []string{
+				"jq", "-R", "-r",
+				jqErrorDef + " " + jqTimeDefs(TimeFormatUTC, []string{"ts"}) + " . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((.) | _jqlogs_times) catch (_jqlogs_error(\"query\"; null), $line)) end",
+			},
+		},
+		{
+			name:    "Unwrap Envelopes",
+			jqQuery: "$envelope.stream",
+			opts:    JqFlagOptions{Raw: true, Unwrap: true},
+			wantArgs: []string{
+				"jq", "-R", "-r",
+				jqErrorDef + ` . as $line | (try (fromjson | [.]) catch null) as $record | if $record == null then $line else ($record[0] | try ((if type == "object" and has("__jqlogs_envelope") then .__jqlogs_envelope else null end) as $envelope | (if $envelope != null then .__jqlogs_record else . end) | $envelope.stream) catch (_jqlogs_error("query"; null), $line)) end`,
+			},
+		},
+		{
+			name:    "Strict",
+			jqQuery: ".msg",
+			opts:    JqFlagOptions{Raw: true, Strict: true},
+			wantArgs: []string{
+				"jq", "-R", "-r",
+				jqErrorDef + " " + jqNumberedInputDef + ` _jqlogs_input as [$n, $line] | ($line | try (fromjson | [.]) catch null) as $record | if $record == null then _jqlogs_error("parse"; $n), $line else ($record[0] | try (.msg) catch _jqlogs_error("query"; $n)) end`,
+			},
+		},
+		{
+			name:    "Slurp",
+			jqQuery: "length",
+			opts:    JqFlagOptions{Slurp: true},
+			wantArgs: []string{
+				"jq", "-r",
+				`(length) | if type=="string" then tojson else . end`,
+			},
+		},
+		{
+			name:    "Slurp With Pre-processing",
+			jqQuery: "map(.id)",
+			opts:    JqFlagOptions{Raw: true, Slurp: true, Unwrap: true, ParseJSON: true},
+			wantArgs: []string{
+				"jq", "-r",
+				jqParseJSONDef + ` map(if type == "string" then . else (if type == "object" and has("__jqlogs_envelope") then .__jqlogs_record else . end) | _jqlogs_parse_json end) | map(.id)`,
+			},
+		},
+		{
+			name:    "Window",
+			jqQuery: "length",
+			opts:    JqFlagOptions{Window: time.Minute, Flatten: true},
+			wantArgs: []string{
+				"jq", "-r",
+				jqFlattenDef + ` {start, end} as $window | .records | map(if type == "string" then . else _jqlogs_flatten end) | (length) | if type=="string" then tojson else . end`,
 			},
 		},
 	}
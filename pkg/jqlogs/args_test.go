@@ -2,7 +2,9 @@ package jqlogs
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseArgs(t *testing.T) {
@@ -143,6 +145,155 @@ func TestParseArgs(t *testing.T) {
 			wantHelp:        false,
 			wantVersion:     false,
 		},
+		{
+			name:            "With Sample Flags",
+			args:            []string{"--sample", "1/100", "--sample-key", ".trace.id", "pod"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{Sample: SampleRate{N: 1, M: 100}, SampleKey: ".trace.id"},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Rate Limit Flag",
+			args:            []string{"-f", "--rate-limit", "200/s", "pod"},
+			wantKubectlArgs: []string{"-f", "pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{RateLimit: RateLimit{Count: 200, Per: time.Second}},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Repeated Highlight Flag",
+			args:            []string{"--highlight", "timeout", "pod", "--highlight", "err(or)?"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{Highlight: []string{"timeout", "err(or)?"}},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Redact Flags",
+			args:            []string{"--redact", "password", "--redact", "preset:email", "--redact-mode", "hash", "pod"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{Redact: []string{"password", "preset:email"}, RedactMode: "hash"},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Record Pre-processing Flags",
+			args:            []string{"--parse-json", "pod", "--flatten", "--unwrap", "--kv"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{ParseJSON: true, Flatten: true, Unwrap: true, KeyValue: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Time Flags",
+			args:            []string{"--time-format", "15:04:05", "pod", "--time-fields", "ts, created", "--time-fields", "at"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{TimeFormat: "15:04:05", TimeFields: []string{"ts", "created", "at"}},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Replay Flags",
+			args:            []string{"--replay", "--buffer", "500", "pod", "--buffer-file"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{Replay: true, Buffer: 500, BufferFile: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Line Flags",
+			args:            []string{"--max-line-size", "4M", "pod", "--max-line-policy", "skip", "--multiline-max", "50", "--no-multiline"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{MaxLineSize: 4 << 20, MaxLinePolicy: MaxLineSkip, MultilineMax: 50, NoMultiline: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Slurp Flags",
+			args:            []string{"--slurp", "pod", "--tail=100", "--slurp-text", "--", "length"},
+			wantKubectlArgs: []string{"pod", "--tail=100"},
+			wantJqQuery:     "length",
+			wantOpts:        JqFlagOptions{Slurp: true, SlurpText: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Window Flags",
+			args:            []string{"-f", "--window", "1m", "pod", "--window-slide", "15s", "--window-grace", "10s", "--", "length"},
+			wantKubectlArgs: []string{"-f", "pod"},
+			wantJqQuery:     "length",
+			wantOpts:        JqFlagOptions{Window: time.Minute, WindowSlide: 15 * time.Second, WindowGrace: 10 * time.Second},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Trace Flags",
+			args:            []string{"--trace-id", "abc", "-n", "ns", "--from", "deploy/web", "--from", "app=api", "--trace-fields", "req_id, trace_id", "--merge-buffer", "500", "--merge-lateness", "5s"},
+			wantKubectlArgs: []string{"-n", "ns"},
+			wantJqQuery:     "",
+			wantOpts: JqFlagOptions{
+				From:          []string{"deploy/web", "app=api"},
+				TraceID:       "abc",
+				TraceFields:   []string{"req_id", "trace_id"},
+				MergeBuffer:   500,
+				MergeLateness: 5 * time.Second,
+			},
+			wantHelp:    false,
+			wantVersion: false,
+		},
+		{
+			name:            "With Previous Flag",
+			args:            []string{"--with-previous", "-n", "ns", "pod", "--", ".msg"},
+			wantKubectlArgs: []string{"-n", "ns", "pod"},
+			wantJqQuery:     ".msg",
+			wantOpts:        JqFlagOptions{WithPrevious: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Strict Flag",
+			args:            []string{"pod", "--strict", "--", ".msg"},
+			wantKubectlArgs: []string{"pod"},
+			wantJqQuery:     ".msg",
+			wantOpts:        JqFlagOptions{Strict: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "With Schema Flag",
+			args:            []string{"--schema", "-n", "ns", "pod"},
+			wantKubectlArgs: []string{"-n", "ns", "pod"},
+			wantJqQuery:     "",
+			wantOpts:        JqFlagOptions{Schema: true},
+			wantHelp:        false,
+			wantVersion:     false,
+		},
+		{
+			name:            "Inline Values",
+			args:            []string{"--indent=4", "--sample=1/10", "--tail=5", "pod"},
+			wantKubectlArgs: []string{"--tail=5", "pod"},
+			wantOpts:        JqFlagOptions{Indent: 4, Sample: SampleRate{N: 1, M: 10}},
+		},
+		{
+			name:            "Boolean Switched Off",
+			args:            []string{"-r", "--raw-output=false", "--tab=true", "pod"},
+			wantKubectlArgs: []string{"pod"},
+			wantOpts:        JqFlagOptions{Tab: true},
+		},
+		{
+			name:     "Config View",
+			args:     []string{"--config-view", "-c"},
+			wantOpts: JqFlagOptions{ConfigView: true, Compact: true},
+		},
 		{
 			name:            "Mixed Flags",
 			args:            []string{"-r", "--indent", "4", "pod", "--", ".msg"},
@@ -159,7 +310,10 @@ func TestParseArgs(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotKubectlArgs, gotJqQuery, gotOpts, gotHelp, gotVersion := ParseArgs(tt.args)
+			gotKubectlArgs, gotJqQuery, gotOpts, gotHelp, gotVersion, err := ParseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("ParseArgs() unexpected error: %v", err)
+			}
 
 			assertStringSliceEqual(t, "kubectlArgs", gotKubectlArgs, tt.wantKubectlArgs)
 
@@ -179,6 +333,36 @@ func TestParseArgs(t *testing.T) {
 	}
 }
 
+func TestParseArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "Missing Value", args: []string{"pod", "--indent"}, wantErr: "--indent requires an argument"},
+		{name: "Invalid Value", args: []string{"--sample", "1/", "pod"}, wantErr: `--sample expects a fraction like 1/100 with 0 < n <= m, got: "1/"`},
+		{name: "Invalid Boolean", args: []string{"--tab=maybe", "pod"}, wantErr: `--tab requires true or false, got: "maybe"`},
+		{name: "First Error Wins", args: []string{"--buffer", "0", "--indent", "9"}, wantErr: `--buffer requires a positive number of lines, got: "0"`},
+		{name: "Missing Config Path", args: []string{"pod", "--config"}, wantErr: "--config requires an argument"},
+		{name: "Conflicting Modes", args: []string{"--tui", "--replay", "pod"}, wantErr: "--tui and --replay cannot be used together"},
+		{name: "Unknown Macro", args: []string{"pod", "--", "@nope"}, wantErr: "@nope"},
+		{name: "Schema With Query", args: []string{"--schema", "pod", "--", ".msg"}, wantErr: "--schema reports the fields of the records as they are read, it cannot be used with a query"},
+		{name: "Container With -c", args: []string{"--with-previous", "-n", "ns", "-c", "app", "my-pod"}, wantErr: "with --container"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubectlArgs, _, _, _, _, err := ParseArgs(tt.args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseArgs() error = %v, want %q", err, tt.wantErr)
+			}
+			if kubectlArgs != nil {
+				t.Errorf("ParseArgs() kubectlArgs = %q on error, want nil", kubectlArgs)
+			}
+		})
+	}
+}
+
 // assertStringSliceEqual is a test helper that compares two string slices,
 // treating nil and empty slices as equal.
 func assertStringSliceEqual(t *testing.T, field string, got, want []string) {
@@ -194,3 +378,22 @@ func assertStringSliceEqual(t *testing.T, field string, got, want []string) {
 		}
 	}
 }
+
+func TestIsFollowing(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{args: []string{"pod"}, want: false},
+		{args: []string{"-f", "pod"}, want: true},
+		{args: []string{"pod", "--follow"}, want: true},
+		{args: []string{"--follow=true", "pod"}, want: true},
+		{args: []string{"-f", "--follow=false", "pod"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isFollowing(tt.args); got != tt.want {
+			t.Errorf("isFollowing(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package jqlogs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultBufferSize is the number of lines kept by --replay and --tui when --buffer is not given.
+const DefaultBufferSize = 10000
+
+// bufferedLine is a line as it came out of the stream filter.
+type bufferedLine struct {
+	line   []byte
+	isJSON bool
+}
+
+// LineBuffer keeps the last lines of the stream so that queries can be re-run over them.
+// Lines are kept in memory, or in temp files with --buffer-file: two segment files of
+// up to max lines each, the older one being deleted when a third would be needed.
+// It is safe for concurrent use: the stream appends while replays read.
+type LineBuffer struct {
+	mu    sync.Mutex
+	max   int
+	added int
+
+	// memory storage; the last max entries are the buffered lines
+	lines []bufferedLine
+
+	// file storage; prev holds the lines before cur
+	dir                 string
+	prev, cur           *os.File
+	prevCount, curCount int
+	writer              *bufio.Writer
+}
+
+// NewLineBuffer creates a buffer of the last max lines, in memory.
+func NewLineBuffer(max int) *LineBuffer {
+	return &LineBuffer{max: max}
+}
+
+// NewFileLineBuffer creates a buffer of the last max lines, stored in temp files in dir
+// (the default temp directory if empty). Close removes the files.
+func NewFileLineBuffer(max int, dir string) (*LineBuffer, error) {
+	b := &LineBuffer{max: max, dir: dir}
+	if err := b.rotate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Add appends a line, dropping the oldest one when the buffer is full.
+func (b *LineBuffer) Add(line []byte, isJSON bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.added++
+
+	if b.cur == nil {
+		b.lines = append(b.lines, bufferedLine{line: append([]byte(nil), line...), isJSON: isJSON})
+		if len(b.lines) > 2*b.max {
+			// Compact once in a while rather than on every line
+			b.lines = append([]bufferedLine(nil), b.lines[len(b.lines)-b.max:]...)
+		}
+		return nil
+	}
+
+	if b.curCount == b.max {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+	flag := byte('t')
+	if isJSON {
+		flag = 'j'
+	}
+	b.writer.WriteByte(flag)
+	b.writer.Write(line)
+	b.writer.WriteByte('\n')
+	b.curCount++
+	// Flush per line, so that replays see everything added so far
+	return b.writer.Flush()
+}
+
+// rotate starts a new segment file, deleting the one before the current one.
+func (b *LineBuffer) rotate() error {
+	f, err := os.CreateTemp(b.dir, "kubectl-jqlogs-buffer-*")
+	if err != nil {
+		return fmt.Errorf("cannot create buffer file: %w", err)
+	}
+	if b.prev != nil {
+		b.prev.Close()
+		os.Remove(b.prev.Name())
+	}
+	b.prev, b.prevCount = b.cur, b.curCount
+	b.cur, b.curCount = f, 0
+	b.writer = bufio.NewWriter(f)
+	return nil
+}
+
+// Len returns the number of buffered lines.
+func (b *LineBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return min(b.added, b.max)
+}
+
+// Added returns the number of lines added since the buffer was created.
+func (b *LineBuffer) Added() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.added
+}
+
+// Each calls fn for every buffered line, oldest first. Lines added meanwhile are not visited.
+func (b *LineBuffer) Each(fn func(line []byte, isJSON bool)) error {
+	b.mu.Lock()
+	if b.cur == nil {
+		lines := b.lines[max(len(b.lines)-b.max, 0):]
+		b.mu.Unlock()
+		for _, l := range lines {
+			fn(l.line, l.isJSON)
+		}
+		return nil
+	}
+
+	// Snapshot which lines of which segments to read. The files are only appended to,
+	// and are opened right away so that a rotation meanwhile doesn't remove them under us.
+	type segment struct {
+		file        *os.File
+		skip, count int
+	}
+	var segments []segment
+	open := func(f *os.File, skip, count int) error {
+		if f == nil || count == 0 {
+			return nil
+		}
+		rf, err := os.Open(f.Name())
+		if err != nil {
+			return fmt.Errorf("cannot read buffer file: %w", err)
+		}
+		segments = append(segments, segment{rf, skip, count})
+		return nil
+	}
+	keep := min(b.prevCount, b.max-b.curCount)
+	err := open(b.prev, b.prevCount-keep, keep)
+	if err == nil {
+		err = open(b.cur, 0, b.curCount)
+	}
+	defer func() {
+		for _, s := range segments {
+			s.file.Close()
+		}
+	}()
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range segments {
+		if err := readSegment(s.file, s.skip, s.count, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSegment(f *os.File, skip, count int, fn func(line []byte, isJSON bool)) error {
+	r := bufio.NewReader(f)
+	for i := 0; i < skip+count; i++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("cannot read buffer file: %w", err)
+		}
+		if i >= skip {
+			fn(line[1:len(line)-1], line[0] == 'j')
+		}
+	}
+	return nil
+}
+
+// bufferSize returns the --buffer size, or the default.
+func (o JqFlagOptions) bufferSize() int {
+	if o.Buffer > 0 {
+		return o.Buffer
+	}
+	return DefaultBufferSize
+}
+
+// Close removes the buffer files, if any.
+func (b *LineBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, f := range []*os.File{b.prev, b.cur} {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	b.prev, b.cur = nil, nil
+	return nil
+}
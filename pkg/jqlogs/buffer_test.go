@@ -0,0 +1,84 @@
+package jqlogs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// bufferContent returns the buffered lines, JSON ones prefixed with "j:"
+func bufferContent(t *testing.T, b *LineBuffer) []string {
+	t.Helper()
+	var lines []string
+	err := b.Each(func(line []byte, isJSON bool) {
+		if isJSON {
+			lines = append(lines, "j:"+string(line))
+		} else {
+			lines = append(lines, string(line))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestLineBuffer(t *testing.T) {
+	dir := t.TempDir()
+	fileBuffer, err := NewFileLineBuffer(3, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, b := range map[string]*LineBuffer{"Memory": NewLineBuffer(3), "File": fileBuffer} {
+		t.Run(name, func(t *testing.T) {
+			defer b.Close()
+			if got := bufferContent(t, b); len(got) != 0 {
+				t.Errorf("empty buffer = %q", got)
+			}
+
+			b.Add([]byte(`{"n":1}`), true)
+			b.Add([]byte("text"), false)
+			if got, want := bufferContent(t, b), []string{`j:{"n":1}`, "text"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("buffer = %q, want %q", got, want)
+			}
+
+			// Only the last 3 lines are kept, across several rotations of the files
+			for i := 2; i <= 10; i++ {
+				b.Add([]byte(fmt.Sprintf(`{"n":%d}`, i)), true)
+			}
+			if got, want := bufferContent(t, b), []string{`j:{"n":8}`, `j:{"n":9}`, `j:{"n":10}`}; !reflect.DeepEqual(got, want) {
+				t.Errorf("buffer = %q, want %q", got, want)
+			}
+			if b.Len() != 3 || b.Added() != 11 {
+				t.Errorf("Len() = %d, Added() = %d, want 3 and 11", b.Len(), b.Added())
+			}
+		})
+	}
+
+	// Disk usage stays bounded and Close cleans up
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("files left after Close: %v", files)
+	}
+}
+
+func TestLineBuffer_FileSegments(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewFileLineBuffer(2, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for i := 0; i < 7; i++ {
+		b.Add([]byte(fmt.Sprint(i)), false)
+		if entries, _ := os.ReadDir(dir); len(entries) > 2 {
+			t.Fatalf("after %d lines: %d buffer files, want at most 2", i+1, len(entries))
+		}
+	}
+	if got, want := bufferContent(t, b), []string{"5", "6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buffer = %q, want %q", got, want)
+	}
+}
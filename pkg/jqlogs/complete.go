@@ -0,0 +1,93 @@
+package jqlogs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CompletionSampleLines is the number of recent log lines read to suggest field paths
+// in shell completion.
+const CompletionSampleLines = 20
+
+// SampleRecords reads the last n lines of the selected logs (with n <= 0, the lines selected
+// by kubectlArgs' --tail) without following, and passes every JSON record to fn as a query
+// would see it: after --unwrap, --redact, --parse-json and --flatten. --sample and
+// --rate-limit are not applied, so that all those lines are read.
+func (r *Runner) SampleRecords(kubectlArgs []string, opts JqFlagOptions, n int, fn func(record any)) error {
+	opts.Sample, opts.RateLimit = SampleRate{}, RateLimit{}
+	opts.TimeFormat = ""
+	filter, err := newStreamFilter(opts)
+	if err != nil {
+		return err
+	}
+	code, err := compileJq(".", opts)
+	if err != nil {
+		return fmt.Errorf("compiling the pre-processing stages: %w", err)
+	}
+
+	r.stream(sampleArgs(kubectlArgs, n), filter, func(line []byte, _ int, isJSON bool) {
+		if !isJSON {
+			return
+		}
+		iter := code.Run(string(line))
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			switch v.(type) {
+			case error, string:
+				// errors, and lines that failed to decode (returned as they are)
+			default:
+				fn(v)
+			}
+		}
+	})
+	return nil
+}
+
+// sampleArgs turns kubectl logs arguments into ones that read the last n lines and exit.
+// With n <= 0, the --tail of the arguments is kept.
+func sampleArgs(kubectlArgs []string, n int) []string {
+	args := make([]string, 0, len(kubectlArgs)+1)
+	for _, arg := range kubectlArgs {
+		if arg == "-f" || arg == "--follow" || strings.HasPrefix(arg, "--follow=") {
+			continue
+		}
+		args = append(args, arg)
+	}
+	if n <= 0 {
+		return args
+	}
+	// The last --tail wins
+	return append(args, fmt.Sprintf("--tail=%d", n))
+}
+
+// CompleteFieldPaths returns the field paths found in records that start with toComplete,
+// for completing a query after "--". A Smart Query label (lvl=.le) is kept in front of the
+// completed path, and .@field is completed to the quoted form jq accepts. Paths through
+// arrays are left out, as Smart Query columns can't iterate.
+func CompleteFieldPaths(records []any, toComplete string) []string {
+	label := ""
+	if i := strings.Index(toComplete, "=."); i > 0 && smartLabelRegexp.MatchString(toComplete) {
+		label, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+	if strings.HasPrefix(toComplete, ".@") {
+		toComplete = `."` + toComplete[1:]
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, record := range records {
+		walkFields(record, func(path string, _ any) {
+			if seen[path] || strings.Contains(path, "[]") || !strings.HasPrefix(path, toComplete) {
+				return
+			}
+			seen[path] = true
+			paths = append(paths, label+path)
+		})
+	}
+	sort.Strings(paths)
+	return paths
+}
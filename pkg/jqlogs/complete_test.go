@@ -0,0 +1,74 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSampleArgs(t *testing.T) {
+	got := sampleArgs([]string{"-f", "-n", "ns", "--follow=true", "pod", "--tail", "100"}, 20)
+	want := []string{"-n", "ns", "pod", "--tail", "100", "--tail=20"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sampleArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestRunner_SampleRecords(t *testing.T) {
+	var gotArgs []string
+	runner := &Runner{
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, stdout io.Writer, stderr io.Writer) error {
+			gotArgs = args
+			io.WriteString(stdout, `{"level":"info","payload":"{\"id\":1}"}`+"\n")
+			io.WriteString(stdout, "plain text\n")
+			io.WriteString(stdout, "{broken\n")
+			return nil
+		},
+	}
+
+	var records []any
+	err := runner.SampleRecords([]string{"-f", "pod"}, JqFlagOptions{ParseJSON: true}, 5, func(record any) {
+		records = append(records, record)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"pod", "--tail=5"}; !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("kubectl args = %q, want %q", gotArgs, want)
+	}
+	// Records are pre-processed like the query would see them (gojq keeps numbers as json.Number)
+	want := []any{map[string]any{"level": "info", "payload": map[string]any{"id": json.Number("1")}}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %#v, want %#v", records, want)
+	}
+}
+
+func TestCompleteFieldPaths(t *testing.T) {
+	records := []any{
+		map[string]any{"level": "info", "@timestamp": "t", "user": map[string]any{"id": 1}},
+		map[string]any{"level": "warn", "latency": 3, "items": []any{map[string]any{"sku": "a"}}},
+	}
+
+	tests := []struct {
+		name       string
+		toComplete string
+		want       []string
+	}{
+		{name: "All", toComplete: "", want: []string{`."@timestamp"`, ".items", ".latency", ".level", ".user", ".user.id"}},
+		{name: "Prefix", toComplete: ".l", want: []string{".latency", ".level"}},
+		{name: "Nested", toComplete: ".user.", want: []string{".user.id"}},
+		{name: "At Field", toComplete: ".@t", want: []string{`."@timestamp"`}},
+		{name: "Label", toComplete: "lvl=.le", want: []string{"lvl=.level"}},
+		{name: "No Match", toComplete: ".x", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompleteFieldPaths(records, tt.toComplete); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompleteFieldPaths(%q) = %q, want %q", tt.toComplete, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// TrailingTextField is the field added to a record for the text that follows it on its line,
+// e.g. {"msg":"hi"} (took 3ms) gives {"msg":"hi","_trailing":"(took 3ms)"}.
+const TrailingTextField = "_trailing"
+
+// splitJSONValues splits a line holding several JSON objects or arrays ({...}{...}) into
+// one record each. Text after the last one is added to it as TrailingTextField when it is
+// an object, or follows as a text line otherwise. Other lines are returned as they are,
+// including text that merely starts with an array, like "[0] server listening".
+func splitJSONValues(l streamLine) []streamLine {
+	if l.text || !startsJSON(l.line) || json.Valid(l.line) {
+		return []streamLine{l}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(l.line))
+	var values []json.RawMessage
+	var end int64
+	for {
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil || !startsJSON(v) {
+			break // scalars don't start a record, they are part of the text
+		}
+		values = append(values, v)
+		end = dec.InputOffset()
+	}
+	trailing := bytes.TrimSpace(l.line[end:])
+	if len(values) == 0 || (values[0][0] != '{' && len(trailing) > 0) {
+		return []streamLine{l} // jq falls back to printing the line
+	}
+
+	lines := make([]streamLine, 0, len(values)+1)
+	for _, v := range values {
+		lines = append(lines, streamLine{line: v, envelope: l.envelope, source: l.source, number: l.number})
+	}
+	if len(trailing) == 0 {
+		return lines
+	}
+	last := &lines[len(lines)-1]
+	if last.line[0] != '{' {
+		return append(lines, streamLine{line: bytes.Clone(trailing), envelope: l.envelope, source: l.source, number: l.number, text: true})
+	}
+	last.line = withTrailingText(last.line, trailing)
+	return lines
+}
+
+// withTrailingText adds TrailingTextField to a JSON object.
+func withTrailingText(object, trailing []byte) []byte {
+	return withField(object, TrailingTextField, string(trailing))
+}
+
+// withField adds a string field to a JSON object, as its last key.
+func withField(object []byte, key, value string) []byte {
+	name, _ := json.Marshal(key)
+	text, _ := json.Marshal(value)
+	field := append(append(name, ':'), text...)
+	inner := bytes.TrimSpace(object[1 : len(object)-1])
+	var buf bytes.Buffer
+	buf.Grow(len(object) + len(field) + 1)
+	buf.WriteByte('{')
+	if len(inner) > 0 {
+		buf.Write(inner)
+		buf.WriteByte(',')
+	}
+	buf.Write(field)
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// startsJSON reports whether the first non-space byte of line opens an object or array.
+func startsJSON(line []byte) bool {
+	trimmed := bytes.TrimLeft(line, " \t\r\n")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
@@ -0,0 +1,44 @@
+package jqlogs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitJSONValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		want     []string
+		wantText []bool
+	}{
+		{name: "Single Value", line: `{"a":1}`, want: []string{`{"a":1}`}},
+		{name: "Plain Text", line: "hello {x}", want: []string{"hello {x}"}},
+		{name: "Not JSON", line: "{broken", want: []string{"{broken"}},
+		{name: "Concatenated", line: `{"a":1}{"b":2} [3]`, want: []string{`{"a":1}`, `{"b":2}`, "[3]"}},
+		{name: "Trailing Text", line: `{"msg":"hi"} (took 3ms)`, want: []string{`{"msg":"hi","_trailing":"(took 3ms)"}`}},
+		{name: "Trailing Scalar Is Text", line: `{} true story`, want: []string{`{"_trailing":"true story"}`}},
+		{name: "Trailing Text After Array", line: `{"a":1}[1] "done"`, want: []string{`{"a":1}`, "[1]", `"done"`}, wantText: []bool{false, false, true}},
+		{name: "Text After Array", line: "[0] server listening", want: []string{"[0] server listening"}},
+		{name: "Text After Arrays", line: "[0][1] compiled successfully", want: []string{"[0][1] compiled successfully"}},
+		{name: "Concatenated Arrays", line: "[0] [1]", want: []string{"[0]", "[1]"}},
+		{name: "Invalid After Values", line: `{"a":1}{"b":`, want: []string{`{"a":1,"_trailing":"{\"b\":"}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var gotText []bool
+			for _, l := range splitJSONValues(streamLine{line: []byte(tt.line)}) {
+				got = append(got, string(l.line))
+				gotText = append(gotText, l.text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitJSONValues(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+			if tt.wantText != nil && !reflect.DeepEqual(gotText, tt.wantText) {
+				t.Errorf("splitJSONValues(%q) text = %v, want %v", tt.line, gotText, tt.wantText)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package jqlogs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// configEnv overrides the config file location (also settable with --config).
+const configEnv = "KUBECTL_JQLOGS_CONFIG"
+
+// DefaultLevelFields are the fields checked for a record's log level
+// when the config does not set level-fields.
+var DefaultLevelFields = []string{"level", "severity", "lvl", "log.level"}
+
+// DefaultLevelColors map log levels to colors when the config does not set level-colors.
+var DefaultLevelColors = map[string]string{
+	"trace": "white",
+	"debug": "cyan",
+	"info":  "green",
+	"warn":  "yellow",
+	"error": "red",
+	"fatal": "magenta",
+}
+
+// levelColorNames are the colors accepted in level-colors.
+var levelColorNames = map[string]bool{
+	"black": true, "red": true, "green": true, "yellow": true,
+	"blue": true, "magenta": true, "cyan": true, "white": true,
+}
+
+// Config is the content of the config file.
+//
+// Settings are merged in this order, later ones winning:
+//  1. built-in defaults
+//  2. the config file's defaults
+//  3. the selected profile (--profile name)
+//  4. command-line flags
+//
+// Booleans can only be switched on by a later layer of the config file (--flag=false switches
+// one off on the command line); lists (highlight, redact) are appended.
+type Config struct {
+	Defaults Profile            `json:"defaults,omitempty"`
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+	// Macros are jq snippets used in queries as @name or @name(args), see ExpandMacros.
+	Macros map[string]string `json:"macros,omitempty"`
+}
+
+// Profile is a named bundle of settings. Keys are the long flag names,
+// plus a default query used when no query is given after "--".
+type Profile struct {
+	Query         string            `json:"query,omitempty"`
+	Raw           bool              `json:"raw-output,omitempty"`
+	Compact       bool              `json:"compact-output,omitempty"`
+	Color         bool              `json:"color-output,omitempty"`
+	Monochrome    bool              `json:"monochrome-output,omitempty"`
+	Yaml          bool              `json:"yaml-output,omitempty"`
+	Tab           bool              `json:"tab,omitempty"`
+	Indent        int               `json:"indent,omitempty"`
+	Unwrap        bool              `json:"unwrap,omitempty"`
+	ParseJSON     bool              `json:"parse-json,omitempty"`
+	Flatten       bool              `json:"flatten,omitempty"`
+	KeyValue      bool              `json:"kv,omitempty"`
+	TimeFormat    string            `json:"time-format,omitempty"`
+	TimeFields    []string          `json:"time-fields,omitempty"`
+	TraceFields   []string          `json:"trace-fields,omitempty"`
+	MergeBuffer   int               `json:"merge-buffer,omitempty"`
+	MergeLateness string            `json:"merge-lateness,omitempty"`
+	Buffer        int               `json:"buffer,omitempty"`
+	BufferFile    bool              `json:"buffer-file,omitempty"`
+	MaxLineSize   string            `json:"max-line-size,omitempty"`
+	MaxLinePolicy string            `json:"max-line-policy,omitempty"`
+	MultilineMax  int               `json:"multiline-max,omitempty"`
+	NoMultiline   bool              `json:"no-multiline,omitempty"`
+	Strict        bool              `json:"strict,omitempty"`
+	Sample        string            `json:"sample,omitempty"`
+	SampleKey     string            `json:"sample-key,omitempty"`
+	RateLimit     string            `json:"rate-limit,omitempty"`
+	Highlight     []string          `json:"highlight,omitempty"`
+	Redact        []string          `json:"redact,omitempty"`
+	RedactMode    string            `json:"redact-mode,omitempty"`
+	LevelFields   []string          `json:"level-fields,omitempty"`
+	LevelColors   map[string]string `json:"level-colors,omitempty"`
+}
+
+// DefaultConfigPath returns the config file location:
+// $KUBECTL_JQLOGS_CONFIG, else $XDG_CONFIG_HOME/kubectl-jqlogs/config.yaml,
+// else ~/.config/kubectl-jqlogs/config.yaml.
+func DefaultConfigPath() string {
+	if p := os.Getenv(configEnv); p != "" {
+		return p
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "kubectl-jqlogs", "config.yaml")
+}
+
+// LoadConfig reads a config file. A missing file yields an empty config.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := ParseMacros(cfg.Macros); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ProfileNames lists the profiles in alphabetical order.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply merges the config defaults and the named profile (if any) into opts.
+// It returns the profile's query, which is used when no query is given on the command line.
+func (c *Config) Apply(profile string, opts *JqFlagOptions) (query string, err error) {
+	if err := c.Defaults.apply(opts); err != nil {
+		return "", fmt.Errorf("defaults: %w", err)
+	}
+	query = c.Defaults.Query
+	if profile == "" {
+		return query, nil
+	}
+	p, ok := c.Profiles[profile]
+	if !ok {
+		available := "none"
+		if names := c.ProfileNames(); len(names) > 0 {
+			available = strings.Join(names, ", ")
+		}
+		return "", fmt.Errorf("unknown profile %q (available: %s)", profile, available)
+	}
+	if err := p.apply(opts); err != nil {
+		return "", fmt.Errorf("profile %q: %w", profile, err)
+	}
+	if p.Query != "" {
+		query = p.Query
+	}
+	return query, nil
+}
+
+// apply merges the settings of p that are set into opts, validating them like the flags.
+func (p Profile) apply(opts *JqFlagOptions) error {
+	opts.Raw = opts.Raw || p.Raw
+	opts.Compact = opts.Compact || p.Compact
+	opts.Color = opts.Color || p.Color
+	opts.Monochrome = opts.Monochrome || p.Monochrome
+	opts.Yaml = opts.Yaml || p.Yaml
+	opts.Tab = opts.Tab || p.Tab
+	opts.Unwrap = opts.Unwrap || p.Unwrap
+	opts.ParseJSON = opts.ParseJSON || p.ParseJSON
+	opts.Flatten = opts.Flatten || p.Flatten
+	opts.KeyValue = opts.KeyValue || p.KeyValue
+	opts.BufferFile = opts.BufferFile || p.BufferFile
+	opts.NoMultiline = opts.NoMultiline || p.NoMultiline
+	opts.Strict = opts.Strict || p.Strict
+	if p.Indent != 0 {
+		if p.Indent < 0 || p.Indent > 7 {
+			return fmt.Errorf("indent requires an integer between 0 and 7, got: %d", p.Indent)
+		}
+		opts.Indent = p.Indent
+	}
+	if p.Buffer != 0 {
+		if p.Buffer < 0 {
+			return fmt.Errorf("buffer requires a positive number of lines, got: %d", p.Buffer)
+		}
+		opts.Buffer = p.Buffer
+	}
+	if p.MergeBuffer != 0 {
+		if p.MergeBuffer < 0 {
+			return fmt.Errorf("merge-buffer requires a positive number of records, got: %d", p.MergeBuffer)
+		}
+		opts.MergeBuffer = p.MergeBuffer
+	}
+	if p.MergeLateness != "" {
+		d, err := ParseDuration(p.MergeLateness, false)
+		if err != nil {
+			return fmt.Errorf("merge-lateness %w", err)
+		}
+		opts.MergeLateness = d
+	}
+	if p.MultilineMax != 0 {
+		if p.MultilineMax < 0 {
+			return fmt.Errorf("multiline-max requires a positive number of lines, got: %d", p.MultilineMax)
+		}
+		opts.MultilineMax = p.MultilineMax
+	}
+	if p.MaxLineSize != "" {
+		size, err := ParseSize(p.MaxLineSize)
+		if err != nil {
+			return fmt.Errorf("max-line-size %w", err)
+		}
+		opts.MaxLineSize = size
+	}
+	if p.MaxLinePolicy != "" {
+		if err := ParseMaxLinePolicy(p.MaxLinePolicy); err != nil {
+			return fmt.Errorf("max-line-policy %w", err)
+		}
+		opts.MaxLinePolicy = p.MaxLinePolicy
+	}
+	if p.TimeFormat != "" {
+		if err := ParseTimeFormat(p.TimeFormat); err != nil {
+			return fmt.Errorf("time-format %w", err)
+		}
+		opts.TimeFormat = p.TimeFormat
+	}
+	if len(p.TimeFields) > 0 {
+		opts.TimeFields = p.TimeFields
+	}
+	if len(p.TraceFields) > 0 {
+		opts.TraceFields = p.TraceFields
+	}
+	if p.Sample != "" {
+		rate, err := ParseSampleRate(p.Sample)
+		if err != nil {
+			return fmt.Errorf("sample %w", err)
+		}
+		opts.Sample = rate
+	}
+	if p.SampleKey != "" {
+		opts.SampleKey = p.SampleKey
+	}
+	if p.RateLimit != "" {
+		limit, err := ParseRateLimit(p.RateLimit)
+		if err != nil {
+			return fmt.Errorf("rate-limit %w", err)
+		}
+		opts.RateLimit = limit
+	}
+	if len(p.Highlight) > 0 {
+		if _, err := NewHighlighter(p.Highlight, false); err != nil {
+			return fmt.Errorf("highlight %w", err)
+		}
+		opts.Highlight = append(opts.Highlight, p.Highlight...)
+	}
+	if len(p.Redact) > 0 || p.RedactMode != "" {
+		if _, err := NewRedactor(p.Redact, p.RedactMode); err != nil {
+			return fmt.Errorf("redact %w", err)
+		}
+		opts.Redact = append(opts.Redact, p.Redact...)
+		if p.RedactMode != "" {
+			opts.RedactMode = p.RedactMode
+		}
+	}
+	if len(p.LevelFields) > 0 {
+		opts.LevelFields = p.LevelFields
+	}
+	if len(p.LevelColors) > 0 {
+		if opts.LevelColors == nil {
+			opts.LevelColors = make(map[string]string, len(p.LevelColors))
+		}
+		for level, color := range p.LevelColors {
+			if !levelColorNames[color] {
+				return fmt.Errorf("level-colors: unknown color %q for level %q", color, level)
+			}
+			opts.LevelColors[strings.ToLower(level)] = color
+		}
+	}
+	return nil
+}
+
+// ProfileFromOptions describes effective options in config file terms, filling in
+// the built-in defaults for settings that were not configured.
+func ProfileFromOptions(query string, opts JqFlagOptions) Profile {
+	p := Profile{
+		Query:         query,
+		Raw:           opts.Raw,
+		Compact:       opts.Compact,
+		Color:         opts.Color,
+		Monochrome:    opts.Monochrome,
+		Yaml:          opts.Yaml,
+		Tab:           opts.Tab,
+		Indent:        opts.Indent,
+		Unwrap:        opts.Unwrap,
+		ParseJSON:     opts.ParseJSON,
+		Flatten:       opts.Flatten,
+		KeyValue:      opts.KeyValue,
+		TimeFormat:    opts.TimeFormat,
+		Buffer:        opts.bufferSize(),
+		BufferFile:    opts.BufferFile,
+		MaxLineSize:   formatSize(opts.maxLineSize()),
+		MaxLinePolicy: opts.maxLinePolicy(),
+		MultilineMax:  opts.multilineMax(),
+		NoMultiline:   opts.NoMultiline,
+		Strict:        opts.Strict,
+		SampleKey:     opts.SampleKey,
+		Highlight:     opts.Highlight,
+		Redact:        opts.Redact,
+		RedactMode:    opts.RedactMode,
+		TraceFields:   opts.traceFields(),
+		MergeBuffer:   opts.mergeBuffer(),
+		MergeLateness: opts.mergeLateness().String(),
+		LevelFields:   opts.levelFields(),
+		LevelColors:   opts.levelColors(),
+	}
+	if p.Query == "" {
+		p.Query = "."
+	}
+	if p.Indent == 0 && !p.Tab {
+		p.Indent = 2
+	}
+	if opts.Sample.Enabled() {
+		p.Sample = fmt.Sprintf("%d/%d", opts.Sample.N, opts.Sample.M)
+		if p.SampleKey == "" {
+			p.SampleKey = defaultSampleKey
+		}
+	}
+	if opts.TimeFormat != "" {
+		p.TimeFields = opts.timeFields()
+	}
+	if opts.RateLimit.Enabled() {
+		p.RateLimit = fmt.Sprintf("%d/%s", opts.RateLimit.Count, opts.RateLimit.Per)
+	}
+	if len(p.Redact) > 0 && p.RedactMode == "" {
+		p.RedactMode = RedactMask
+	}
+	return p
+}
+
+// levelFields returns the configured level fields, or the built-in defaults.
+func (o JqFlagOptions) levelFields() []string {
+	if len(o.LevelFields) > 0 {
+		return o.LevelFields
+	}
+	return DefaultLevelFields
+}
+
+// levelColors returns the built-in level colors overlaid with the configured ones.
+func (o JqFlagOptions) levelColors() map[string]string {
+	colors := make(map[string]string, len(DefaultLevelColors)+len(o.LevelColors))
+	for level, color := range DefaultLevelColors {
+		colors[level] = color
+	}
+	for level, color := range o.LevelColors {
+		colors[level] = color
+	}
+	return colors
+}
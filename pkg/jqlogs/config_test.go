@@ -0,0 +1,248 @@
+package jqlogs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the developer's own config file out of ParseArgs tests
+	os.Setenv(configEnv, filepath.Join(os.TempDir(), "kubectl-jqlogs-test", "missing.yaml"))
+	os.Exit(m.Run())
+}
+
+// writeConfig writes a config file into a temp dir and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfig = `
+defaults:
+  compact-output: true
+  indent: 4
+  redact: [password]
+  level-colors:
+    WARN: magenta
+profiles:
+  java:
+    query: .level .logger .message
+    parse-json: true
+    raw-output: true
+    indent: 6
+    redact: [preset:jwt]
+  busy:
+    sample: 1/10
+    rate-limit: 100/s
+    max-line-size: 4M
+    max-line-policy: skip
+    strict: true
+    trace-fields: [request_id]
+    merge-lateness: 5s
+macros:
+  errors: select(.level == "error")
+`
+
+func TestDefaultConfigPath(t *testing.T) {
+	t.Setenv(configEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got, want := DefaultConfigPath(), filepath.Join("/xdg", "kubectl-jqlogs", "config.yaml"); got != want {
+		t.Errorf("DefaultConfigPath() = %q, want %q", got, want)
+	}
+
+	t.Setenv(configEnv, "/custom.yaml")
+	if got := DefaultConfigPath(); got != "/custom.yaml" {
+		t.Errorf("DefaultConfigPath() = %q, want %q", got, "/custom.yaml")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.ProfileNames(); !reflect.DeepEqual(got, []string{"busy", "java"}) {
+		t.Errorf("ProfileNames() = %v", got)
+	}
+
+	// A missing file is an empty config
+	cfg, err = LoadConfig(filepath.Join(t.TempDir(), "nope.yaml"))
+	if err != nil || len(cfg.Profiles) != 0 {
+		t.Errorf("LoadConfig(missing) = %+v, %v, want empty config", cfg, err)
+	}
+
+	// Invalid macros are reported when loading
+	if _, err := LoadConfig(writeConfig(t, "macros:\n  csv: .\n")); err == nil {
+		t.Error("expected error for invalid macro")
+	}
+
+	// Typos are reported instead of silently ignored
+	if _, err := LoadConfig(writeConfig(t, "defaults:\n  raw: true\n")); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		profile   string
+		wantQuery string
+		wantOpts  JqFlagOptions
+		wantErr   bool
+	}{
+		{
+			name:    "Defaults Only",
+			profile: "",
+			wantOpts: JqFlagOptions{
+				Compact:     true,
+				Indent:      4,
+				Redact:      []string{"password"},
+				LevelColors: map[string]string{"warn": "magenta"},
+			},
+		},
+		{
+			name:      "Profile Over Defaults",
+			profile:   "java",
+			wantQuery: ".level .logger .message",
+			wantOpts: JqFlagOptions{
+				Raw:         true,
+				Compact:     true,
+				Indent:      6,
+				ParseJSON:   true,
+				Redact:      []string{"password", "preset:jwt"},
+				LevelColors: map[string]string{"warn": "magenta"},
+			},
+		},
+		{
+			name:    "Profile With Stream Options",
+			profile: "busy",
+			wantOpts: JqFlagOptions{
+				Compact:       true,
+				Indent:        4,
+				Sample:        SampleRate{N: 1, M: 10},
+				RateLimit:     RateLimit{Count: 100, Per: time.Second},
+				MaxLineSize:   4 << 20,
+				MaxLinePolicy: MaxLineSkip,
+				Strict:        true,
+				TraceFields:   []string{"request_id"},
+				MergeLateness: 5 * time.Second,
+				Redact:        []string{"password"},
+				LevelColors:   map[string]string{"warn": "magenta"},
+			},
+		},
+		{
+			name:    "Unknown Profile",
+			profile: "nope",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts JqFlagOptions
+			query, err := cfg.Apply(tt.profile, &opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if query != tt.wantQuery {
+				t.Errorf("Apply() query = %q, want %q", query, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(opts, tt.wantOpts) {
+				t.Errorf("Apply() opts = %+v, want %+v", opts, tt.wantOpts)
+			}
+		})
+	}
+}
+
+func TestConfig_Apply_Invalid(t *testing.T) {
+	for _, content := range []string{
+		"defaults:\n  indent: 9\n",
+		"defaults:\n  sample: half\n",
+		"defaults:\n  redact: ['re:(']\n",
+		"defaults:\n  level-colors: {error: crimson}\n",
+		"defaults:\n  time-format: nope\n",
+		"defaults:\n  max-line-size: huge\n",
+		"defaults:\n  max-line-policy: drop\n",
+		"defaults:\n  merge-lateness: soon\n",
+	} {
+		cfg, err := LoadConfig(writeConfig(t, content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.Apply("", &JqFlagOptions{}); err == nil {
+			t.Errorf("Apply() expected error for config %q", content)
+		}
+	}
+}
+
+func TestParseArgs_Config(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	// Command-line flags and query win over the profile
+	kubectlArgs, jqQuery, opts, _, _, _ := ParseArgs([]string{"--config", path, "--profile", "java", "--indent", "1", "pod", "--", ".msg"})
+	assertStringSliceEqual(t, "kubectlArgs", kubectlArgs, []string{"pod"})
+	if jqQuery != ".msg" {
+		t.Errorf("jqQuery = %q, want .msg", jqQuery)
+	}
+	if opts.Indent != 1 || !opts.Raw || !opts.Compact {
+		t.Errorf("opts = %+v, want profile merged with --indent 1", opts)
+	}
+
+	// Without a query, the profile's query is used
+	_, jqQuery, _, _, _, _ = ParseArgs([]string{"--profile", "java", "--config", path, "pod"})
+	if jqQuery != ".level .logger .message" {
+		t.Errorf("jqQuery = %q, want profile query", jqQuery)
+	}
+
+	// Booleans of the profile can be switched off
+	_, _, opts, _, _, _ = ParseArgs([]string{"--config=" + path, "--profile=java", "--parse-json=false", "pod"})
+	if opts.ParseJSON || !opts.Raw {
+		t.Errorf("opts = %+v, want the profile without parse-json", opts)
+	}
+
+	// Macros from the config are expanded
+	_, jqQuery, opts, _, _, _ = ParseArgs([]string{"--config", path, "pod", "--", "@errors", "|", ".msg"})
+	if want := `(select(.level == "error")) | .msg`; jqQuery != want {
+		t.Errorf("jqQuery = %q, want %q", jqQuery, want)
+	}
+	if opts.typedQuery != "@errors | .msg" {
+		t.Errorf("typedQuery = %q, want the query as typed", opts.typedQuery)
+	}
+}
+
+func TestProfileFromOptions(t *testing.T) {
+	p := ProfileFromOptions("", JqFlagOptions{
+		Raw:       true,
+		Sample:    SampleRate{N: 1, M: 100},
+		RateLimit: RateLimit{Count: 200, Per: time.Second},
+		Redact:    []string{"password"},
+	})
+
+	if p.Query != "." || p.Indent != 2 || !p.Raw {
+		t.Errorf("ProfileFromOptions() = %+v, want built-in defaults filled in", p)
+	}
+	if p.Sample != "1/100" || p.SampleKey != defaultSampleKey || p.RateLimit != "200/1s" || p.RedactMode != RedactMask {
+		t.Errorf("ProfileFromOptions() = %+v, want stream options in flag syntax", p)
+	}
+	if p.MaxLineSize != "1M" || p.MaxLinePolicy != MaxLineTruncate {
+		t.Errorf("ProfileFromOptions() = %+v, want the default line size limit", p)
+	}
+	if !reflect.DeepEqual(p.LevelFields, DefaultLevelFields) || p.LevelColors["error"] != "red" {
+		t.Errorf("ProfileFromOptions() = %+v, want default levels", p)
+	}
+}
@@ -0,0 +1,215 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+)
+
+// Keys of the object the Runner sends to jq for an unwrapped record.
+// The jq wrapper binds the envelope to $envelope and continues with the record,
+// so user queries are written against the inner payload as usual.
+const (
+	envelopeKey       = "__jqlogs_envelope"
+	envelopeRecordKey = "__jqlogs_record"
+)
+
+// Envelope formats reported in $envelope.format
+const (
+	EnvelopeCRI       = "cri"
+	EnvelopeDocker    = "docker"
+	EnvelopeFluentBit = "fluent-bit"
+)
+
+// criLineRegexp matches the CRI log format written by containerd and CRI-O:
+// "<RFC3339 time> <stream> <P|F> <content>", where P marks a partial line.
+var criLineRegexp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\S+) (stdout|stderr) ([PF]) ?(.*)$`)
+
+// Unwrapper detects container runtime and log shipper envelopes and extracts the
+// application payload from them. Partial lines (CRI "P" tag, Docker lines split
+// without a trailing newline) are buffered until the final chunk arrives.
+type Unwrapper struct {
+	max     int // bytes of an assembled line kept in memory, 0 for no limit
+	partial map[string]*partialLine
+	size    int // full size of the last payload
+}
+
+// partialLine is a line assembled from partial chunks: its first max bytes, and its full size.
+type partialLine struct {
+	buf  []byte
+	size int
+}
+
+// NewUnwrapper creates an Unwrapper. Of a line assembled from partial chunks, only the
+// first max bytes are kept in memory (0 for no limit); the rest is counted, then dropped.
+func NewUnwrapper(max int) *Unwrapper {
+	return &Unwrapper{max: max, partial: make(map[string]*partialLine)}
+}
+
+// Unwrap returns the payload of an enveloped line and the envelope metadata, and the full
+// size of the payload, which is larger than len(payload) when it was cut at max bytes.
+// ok is false when the line has no recognized envelope; it should then be used as is.
+// When the line is only a partial chunk, ok is true and payload is nil.
+func (u *Unwrapper) Unwrap(line []byte) (payload []byte, size int, envelope map[string]any, ok bool) {
+	u.size = 0
+	trimmed := bytes.TrimLeft(line, " \t")
+	if len(trimmed) == 0 {
+		return nil, 0, nil, false
+	}
+	switch trimmed[0] {
+	case '{':
+		payload, envelope, ok = u.unwrapObject(trimmed)
+	case '[':
+		payload, envelope, ok = u.unwrapFluentBitEvent(trimmed)
+	default:
+		payload, envelope, ok = u.unwrapCRI(line)
+	}
+	size = len(payload)
+	if u.size > size {
+		size = u.size
+	}
+	return payload, size, envelope, ok
+}
+
+func (u *Unwrapper) unwrapCRI(line []byte) ([]byte, map[string]any, bool) {
+	m := criLineRegexp.FindSubmatch(line)
+	if m == nil {
+		return nil, nil, false
+	}
+	envelope := map[string]any{
+		"format": EnvelopeCRI,
+		"time":   string(m[1]),
+		"stream": string(m[2]),
+	}
+	payload := u.assemble(EnvelopeCRI+"/"+string(m[2]), m[4], string(m[3]) == "P")
+	return payload, envelope, true
+}
+
+func (u *Unwrapper) unwrapObject(line []byte) ([]byte, map[string]any, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, nil, false
+	}
+	var log string
+	if raw, ok := fields["log"]; !ok || json.Unmarshal(raw, &log) != nil {
+		return nil, nil, false
+	}
+
+	// Docker json-file driver: {"log":"...\n","stream":"stdout","time":"..."} (plus optional "attrs")
+	if isDockerEnvelope(fields) {
+		envelope := envelopeFields(EnvelopeDocker, fields)
+		var stream string
+		json.Unmarshal(fields["stream"], &stream)
+		partial := len(log) > 0 && log[len(log)-1] != '\n'
+		payload := u.assemble(EnvelopeDocker+"/"+stream, bytes.TrimRight([]byte(log), "\r\n"), partial)
+		return payload, envelope, true
+	}
+
+	// fluent-bit records keep the original line in "log" next to shipper metadata
+	_, hasKubernetes := fields["kubernetes"]
+	_, hasDate := fields["date"]
+	if !hasKubernetes && !hasDate {
+		return nil, nil, false
+	}
+	return bytes.TrimRight([]byte(log), "\r\n"), envelopeFields(EnvelopeFluentBit, fields), true
+}
+
+// unwrapFluentBitEvent handles fluent-bit's JSON event forms: [time, record] and
+// [[time, metadata], record]. The record's "log" field, if any, is the payload.
+func (u *Unwrapper) unwrapFluentBitEvent(line []byte) ([]byte, map[string]any, bool) {
+	var event []json.RawMessage
+	if err := json.Unmarshal(line, &event); err != nil || len(event) != 2 {
+		return nil, nil, false
+	}
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(event[1], &record); err != nil {
+		return nil, nil, false
+	}
+
+	var header []json.RawMessage
+	var ts json.Number
+	if err := json.Unmarshal(event[0], &ts); err == nil {
+		header = []json.RawMessage{event[0]}
+	} else if err := json.Unmarshal(event[0], &header); err != nil || len(header) != 2 {
+		return nil, nil, false
+	}
+
+	var log string
+	payload := []byte(event[1])
+	envelope := map[string]any{"format": EnvelopeFluentBit}
+	if raw, ok := record["log"]; ok && json.Unmarshal(raw, &log) == nil {
+		payload = bytes.TrimRight([]byte(log), "\r\n")
+		envelope = envelopeFields(EnvelopeFluentBit, record)
+	}
+	envelope["time"] = header[0]
+	if len(header) == 2 {
+		envelope["metadata"] = header[1]
+	}
+	return payload, envelope, true
+}
+
+// envelopeFields collects the envelope metadata: every field except the payload in "log".
+func envelopeFields(format string, fields map[string]json.RawMessage) map[string]any {
+	envelope := map[string]any{"format": format}
+	for k, raw := range fields {
+		if k != "log" {
+			envelope[k] = raw
+		}
+	}
+	return envelope
+}
+
+// assemble buffers partial chunks per key and returns the full payload once the final chunk
+// arrives. Past max bytes, chunks are only counted.
+func (u *Unwrapper) assemble(key string, chunk []byte, partial bool) []byte {
+	p, ok := u.partial[key]
+	if !ok {
+		p = &partialLine{buf: []byte{}} // an empty final chunk is still a (blank) line
+	}
+	p.size += len(chunk)
+	if u.max > 0 {
+		chunk = chunk[:min(len(chunk), max(u.max-len(p.buf), 0))]
+	}
+	p.buf = append(p.buf, chunk...)
+	if partial {
+		u.partial[key] = p
+		return nil
+	}
+	delete(u.partial, key)
+	u.size = p.size
+	return p.buf
+}
+
+// isDockerEnvelope reports whether the fields are exactly those of Docker's json-file driver.
+func isDockerEnvelope(fields map[string]json.RawMessage) bool {
+	if _, ok := fields["stream"]; !ok {
+		return false
+	}
+	if _, ok := fields["time"]; !ok {
+		return false
+	}
+	for k := range fields {
+		switch k {
+		case "log", "stream", "time", "attrs":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// wrapEnveloped builds the object the jq wrapper expects for an unwrapped JSON payload.
+func wrapEnveloped(payload []byte, envelope map[string]any) []byte {
+	meta, err := json.Marshal(envelope)
+	if err != nil {
+		return payload
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(payload) + len(meta) + 48)
+	buf.WriteString(`{"` + envelopeKey + `":`)
+	buf.Write(meta)
+	buf.WriteString(`,"` + envelopeRecordKey + `":`)
+	buf.Write(payload)
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,174 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUnwrapper_Unwrap(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		wantPayload string
+		wantFormat  string
+		wantStream  string
+		wantOK      bool
+	}{
+		{
+			name:        "CRI Full Line",
+			lines:       []string{`2026-01-15T10:00:00.123456789Z stdout F {"msg":"hi"}`},
+			wantPayload: `{"msg":"hi"}`,
+			wantFormat:  EnvelopeCRI,
+			wantStream:  "stdout",
+			wantOK:      true,
+		},
+		{
+			name: "CRI Partial Lines",
+			lines: []string{
+				`2026-01-15T10:00:00Z stderr P {"msg":`,
+				`2026-01-15T10:00:00Z stderr P "a long`,
+				`2026-01-15T10:00:00Z stderr F  line"}`,
+			},
+			wantPayload: `{"msg":"a long line"}`,
+			wantFormat:  EnvelopeCRI,
+			wantStream:  "stderr",
+			wantOK:      true,
+		},
+		{
+			name:        "CRI Empty Line",
+			lines:       []string{`2026-01-15T10:00:00Z stdout F `},
+			wantPayload: ``,
+			wantFormat:  EnvelopeCRI,
+			wantStream:  "stdout",
+			wantOK:      true,
+		},
+		{
+			name:        "Docker JSON File",
+			lines:       []string{`{"log":"{\"msg\":\"hi\"}\n","stream":"stdout","time":"2026-01-15T10:00:00Z"}`},
+			wantPayload: `{"msg":"hi"}`,
+			wantFormat:  EnvelopeDocker,
+			wantStream:  "stdout",
+			wantOK:      true,
+		},
+		{
+			name: "Docker Split Line",
+			lines: []string{
+				`{"log":"{\"msg\":","stream":"stdout","time":"2026-01-15T10:00:00Z"}`,
+				`{"log":"\"hi\"}\n","stream":"stdout","time":"2026-01-15T10:00:00Z"}`,
+			},
+			wantPayload: `{"msg":"hi"}`,
+			wantFormat:  EnvelopeDocker,
+			wantStream:  "stdout",
+			wantOK:      true,
+		},
+		{
+			name:        "Fluent Bit Record",
+			lines:       []string{`{"date":1760600000.5,"log":"plain text","stream":"stderr","kubernetes":{"pod_name":"p"}}`},
+			wantPayload: `plain text`,
+			wantFormat:  EnvelopeFluentBit,
+			wantStream:  "stderr",
+			wantOK:      true,
+		},
+		{
+			name:        "Fluent Bit Event",
+			lines:       []string{`[1760600000.5,{"log":"{\"msg\":\"hi\"}\n","stream":"stdout"}]`},
+			wantPayload: `{"msg":"hi"}`,
+			wantFormat:  EnvelopeFluentBit,
+			wantStream:  "stdout",
+			wantOK:      true,
+		},
+		{
+			name:        "Fluent Bit Event Without Log",
+			lines:       []string{`[[1760600000.5,{}],{"msg":"hi"}]`},
+			wantPayload: `{"msg":"hi"}`,
+			wantFormat:  EnvelopeFluentBit,
+			wantOK:      true,
+		},
+		{
+			name:   "App Record With Log Field",
+			lines:  []string{`{"log":"user log","level":"info"}`},
+			wantOK: false,
+		},
+		{
+			name:   "Plain Text",
+			lines:  []string{`2026-01-15 10:00:00 INFO started`},
+			wantOK: false,
+		},
+		{
+			name:   "Plain Array",
+			lines:  []string{`[1, 2, 3]`},
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUnwrapper(0)
+			var payload []byte
+			var envelope map[string]any
+			var ok bool
+			for i, line := range tt.lines {
+				payload, _, envelope, ok = u.Unwrap([]byte(line))
+				if i < len(tt.lines)-1 && (!ok || payload != nil) {
+					t.Fatalf("line %d: expected a buffered partial chunk, got %q, %v", i, payload, ok)
+				}
+			}
+
+			if ok != tt.wantOK {
+				t.Fatalf("Unwrap() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if string(payload) != tt.wantPayload || payload == nil {
+				t.Errorf("Unwrap() payload = %q, want %q", payload, tt.wantPayload)
+			}
+			if envelope["format"] != tt.wantFormat {
+				t.Errorf("Unwrap() format = %v, want %v", envelope["format"], tt.wantFormat)
+			}
+			if tt.wantStream != "" {
+				var stream string
+				switch v := envelope["stream"].(type) {
+				case string:
+					stream = v
+				case json.RawMessage:
+					json.Unmarshal(v, &stream)
+				}
+				if stream != tt.wantStream {
+					t.Errorf("Unwrap() stream = %q, want %q", stream, tt.wantStream)
+				}
+			}
+		})
+	}
+}
+
+func TestUnwrapper_UnwrapMax(t *testing.T) {
+	// Of a line assembled from partial chunks, only the first max bytes are kept
+	u := NewUnwrapper(8)
+	for i := 0; i < 100; i++ {
+		if payload, _, _, ok := u.Unwrap([]byte(`2026-01-15T10:00:00Z stdout P 0123456789`)); !ok || payload != nil {
+			t.Fatalf("chunk %d: expected a buffered partial chunk, got %q, %v", i, payload, ok)
+		}
+	}
+	if got := len(u.partial["cri/stdout"].buf); got != 8 {
+		t.Errorf("buffered %d bytes, want 8", got)
+	}
+	payload, size, _, _ := u.Unwrap([]byte(`2026-01-15T10:00:00Z stdout F end`))
+	if string(payload) != "01234567" || size != 1003 {
+		t.Errorf("Unwrap() = %q, %d, want %q, 1003", payload, size, "01234567")
+	}
+
+	// Lines that fit are not cut
+	payload, size, _, _ = u.Unwrap([]byte(`2026-01-15T10:00:00Z stdout F short`))
+	if string(payload) != "short" || size != 5 {
+		t.Errorf("Unwrap() = %q, %d, want %q, 5", payload, size, "short")
+	}
+}
+
+func TestWrapEnveloped(t *testing.T) {
+	got := wrapEnveloped([]byte(`{"msg":"hi"}`), map[string]any{"format": EnvelopeCRI})
+	want := `{"__jqlogs_envelope":{"format":"cri"},"__jqlogs_record":{"msg":"hi"}}`
+	if string(got) != want {
+		t.Errorf("wrapEnveloped() = %s, want %s", got, want)
+	}
+}
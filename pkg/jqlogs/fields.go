@@ -0,0 +1,73 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// lookupField resolves a dotted field path like ".trace.id" (the leading dot is optional)
+// against a decoded JSON value. It only walks objects; array indexes are not supported.
+func lookupField(v any, path string) (any, bool) {
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// maxFieldDepth bounds how deep walkFields descends into nested values.
+const maxFieldDepth = 8
+
+// walkFields calls fn with the jq path and value of every field in a decoded JSON value,
+// parents before their children, keys in alphabetical order. Array elements are walked
+// under the iterator: {"items":[{"id":1}]} gives .items, .items[] and .items[].id.
+func walkFields(v any, fn func(path string, value any)) {
+	walkFieldsAt(v, "", 0, fn)
+}
+
+func walkFieldsAt(v any, prefix string, depth int, fn func(path string, value any)) {
+	if depth == maxFieldDepth {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path := prefix + fieldPathKey(key)
+			fn(path, v[key])
+			walkFieldsAt(v[key], path, depth+1, fn)
+		}
+	case []any:
+		for _, elem := range v {
+			fn(prefix+"[]", elem)
+			walkFieldsAt(elem, prefix+"[]", depth+1, fn)
+		}
+	}
+}
+
+// fieldPathKey returns the jq path step for an object key: .key, or ."key" when the key
+// is not an identifier.
+func fieldPathKey(key string) string {
+	if fieldIdentRegexp.MatchString(key) {
+		return "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return "." + string(quoted)
+}
+
+var fieldIdentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
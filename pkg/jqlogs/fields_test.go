@@ -0,0 +1,56 @@
+package jqlogs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupField(t *testing.T) {
+	record := map[string]any{
+		"level": "info",
+		"trace": map[string]any{"id": "abc"},
+		"items": []any{1, 2},
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		want   any
+		wantOK bool
+	}{
+		{name: "Top Level", path: ".level", want: "info", wantOK: true},
+		{name: "Without Leading Dot", path: "level", want: "info", wantOK: true},
+		{name: "Nested", path: ".trace.id", want: "abc", wantOK: true},
+		{name: "Identity", path: ".", want: record, wantOK: true},
+		{name: "Missing", path: ".user", want: nil, wantOK: false},
+		{name: "Through Non-Object", path: ".level.x", want: nil, wantOK: false},
+		{name: "Through Array", path: ".items.0", want: nil, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lookupField(record, tt.path)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupField(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestWalkFields(t *testing.T) {
+	record := map[string]any{
+		"msg":        "hi",
+		"@timestamp": "2024-01-01T00:00:00Z",
+		"user":       map[string]any{"id": 1.0},
+		"items":      []any{map[string]any{"sku": "a"}, map[string]any{"qty": 2.0}},
+	}
+
+	var got []string
+	walkFields(record, func(path string, _ any) {
+		got = append(got, path)
+	})
+	want := []string{`."@timestamp"`, ".items", ".items[]", ".items[].sku", ".items[]", ".items[].qty", ".msg", ".user", ".user.id"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walkFields() paths = %q, want %q", got, want)
+	}
+}
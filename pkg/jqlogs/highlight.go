@@ -0,0 +1,242 @@
+package jqlogs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Highlighting uses reverse video on/off instead of a full SGR reset, so a match inside
+// a string colorized by -C keeps the string's color after the highlight ends.
+const (
+	highlightOn  = "\x1b[7m"
+	highlightOff = "\x1b[27m"
+)
+
+// yamlKeyRegexp splits a YAML output line into its key prefix and value:
+// indentation, sequence dashes, and an optional (possibly quoted) mapping key.
+var yamlKeyRegexp = regexp.MustCompile(`^(\s*(?:- )*(?:(?:"(?:[^"\\]|\\.)*"|'[^']*'|[^\s:#'"-][^:#]*?):(?: |$))?)(.*)$`)
+
+// Highlighter marks regex matches inside string values of formatted output.
+type Highlighter struct {
+	re   *regexp.Regexp
+	yaml bool
+}
+
+// NewHighlighter compiles the --highlight patterns into one highlighter.
+// yaml selects YAML-aware instead of JSON-aware handling of formatted lines.
+func NewHighlighter(patterns []string, yaml bool) (*Highlighter, error) {
+	alternatives := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		alternatives = append(alternatives, "(?:"+p+")")
+	}
+	re, err := regexp.Compile(strings.Join(alternatives, "|"))
+	if err != nil {
+		return nil, err
+	}
+	return &Highlighter{re: re, yaml: yaml}, nil
+}
+
+// Text highlights every match in a plain text line.
+func (h *Highlighter) Text(line string) string {
+	return h.re.ReplaceAllStringFunc(line, func(m string) string {
+		if m == "" {
+			return m
+		}
+		return highlightOn + m + highlightOff
+	})
+}
+
+// Formatted highlights matches in a line printed by jq, touching only string values
+// so keys, punctuation and escape sequences stay intact. Lines that are not JSON
+// (raw strings, fallback lines) are highlighted as plain text.
+func (h *Highlighter) Formatted(line string) string {
+	if h.yaml {
+		m := yamlKeyRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return h.Text(line)
+		}
+		return m[1] + h.Text(m[2])
+	}
+	if !looksLikeJSONOutput(line) {
+		return h.Text(line)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case '\x1b':
+			j := skipEscape(line, i)
+			b.WriteString(line[i:j])
+			i = j
+		case '"':
+			end := closingQuote(line, i)
+			if end < 0 {
+				b.WriteString(line[i:])
+				return b.String()
+			}
+			if isObjectKey(line, end+1) {
+				b.WriteString(line[i : end+1])
+			} else {
+				b.WriteByte('"')
+				b.WriteString(h.Text(line[i+1 : end]))
+				b.WriteByte('"')
+			}
+			i = end + 1
+		default:
+			b.WriteByte(line[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// Writer returns a line-buffered writer that highlights each line before passing it to w.
+// With formatted set, lines are treated as jq output; otherwise as plain text.
+// Callers must Flush the writer once writing is done.
+func (h *Highlighter) Writer(w io.Writer, formatted bool) *HighlightWriter {
+	return &HighlightWriter{h: h, w: w, formatted: formatted}
+}
+
+// HighlightWriter is an io.Writer that highlights complete lines.
+type HighlightWriter struct {
+	h         *Highlighter
+	w         io.Writer
+	formatted bool
+	buf       []byte
+}
+
+// Write buffers p and emits every complete line in it.
+func (hw *HighlightWriter) Write(p []byte) (int, error) {
+	hw.buf = append(hw.buf, p...)
+	for {
+		idx := bytes.IndexByte(hw.buf, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		if err := hw.emit(string(hw.buf[:idx]), true); err != nil {
+			return len(p), err
+		}
+		hw.buf = hw.buf[idx+1:]
+	}
+}
+
+// Flush emits a trailing line that has no newline yet.
+func (hw *HighlightWriter) Flush() error {
+	if len(hw.buf) == 0 {
+		return nil
+	}
+	err := hw.emit(string(hw.buf), false)
+	hw.buf = nil
+	return err
+}
+
+func (hw *HighlightWriter) emit(line string, newline bool) error {
+	if hw.formatted {
+		line = hw.h.Formatted(line)
+	} else {
+		line = hw.h.Text(line)
+	}
+	if newline {
+		line += "\n"
+	}
+	_, err := io.WriteString(hw.w, line)
+	return err
+}
+
+// isTerminal reports whether w is a terminal. It is a variable so tests can stub it.
+var isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
+
+// looksLikeJSONOutput reports whether a jq output line is (part of) a JSON text,
+// as opposed to a raw string printed by -r or the hybrid fallback.
+func looksLikeJSONOutput(line string) bool {
+	s := strings.TrimSpace(stripEscapes(line))
+	if s == "" {
+		return false
+	}
+	switch s[0] {
+	case '{', '}', '[', ']', '"':
+		return true
+	}
+	s = strings.TrimSuffix(s, ",")
+	switch s {
+	case "true", "false", "null":
+		return true
+	}
+	return strings.Trim(s, "-+.eE0123456789") == ""
+}
+
+// skipEscape returns the index just past the ANSI escape sequence starting at line[i].
+func skipEscape(line string, i int) int {
+	j := i + 1
+	if j < len(line) && line[j] == '[' {
+		j++
+		for j < len(line) && (line[j] < 0x40 || line[j] > 0x7e) {
+			j++
+		}
+	}
+	if j < len(line) {
+		j++
+	}
+	return j
+}
+
+// stripEscapes removes ANSI escape sequences from line.
+func stripEscapes(line string) string {
+	if !strings.Contains(line, "\x1b") {
+		return line
+	}
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' {
+			i = skipEscape(line, i)
+			continue
+		}
+		b.WriteByte(line[i])
+		i++
+	}
+	return b.String()
+}
+
+// closingQuote returns the index of the quote ending the JSON string opened at line[start],
+// or -1 if the string is not terminated on this line.
+func closingQuote(line string, start int) int {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// isObjectKey reports whether the string ending just before line[i] is an object key,
+// i.e. the next significant character is a colon.
+func isObjectKey(line string, i int) bool {
+	for i < len(line) {
+		switch line[i] {
+		case '\x1b':
+			i = skipEscape(line, i)
+		case ' ', '\t':
+			i++
+		case ':':
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
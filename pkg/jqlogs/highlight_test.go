@@ -0,0 +1,134 @@
+package jqlogs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// mark renders s the way the highlighter marks a match, for readable expectations.
+func mark(s string) string {
+	return highlightOn + s + highlightOff
+}
+
+func TestHighlighter_Formatted_JSON(t *testing.T) {
+	h, err := NewHighlighter([]string{"timeout", "level"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Pretty Value",
+			input: `  "msg": "read timeout after 5s",`,
+			want:  `  "msg": "read ` + mark("timeout") + ` after 5s",`,
+		},
+		{
+			name:  "Key Is Untouched",
+			input: `  "level": "info",`,
+			want:  `  "level": "info",`,
+		},
+		{
+			name:  "Compact Object",
+			input: `{"level":"level timeout","n":1}`,
+			want:  `{"level":"` + mark("level") + ` ` + mark("timeout") + `","n":1}`,
+		},
+		{
+			name:  "Escaped Quote In Value",
+			input: `{"msg":"say \"timeout\""}`,
+			want:  `{"msg":"say \"` + mark("timeout") + `\""}`,
+		},
+		{
+			name:  "Colorized Output Keeps Colors",
+			input: "\x1b[34;1m\"msg\"\x1b[0m: \x1b[32m\"timeout\"\x1b[0m",
+			want:  "\x1b[34;1m\"msg\"\x1b[0m: \x1b[32m\"" + mark("timeout") + "\"\x1b[0m",
+		},
+		{
+			name:  "Raw Output Line",
+			input: `connection timeout on level 3`,
+			want:  `connection ` + mark("timeout") + ` on ` + mark("level") + ` 3`,
+		},
+		{
+			name:  "Number Line",
+			input: `  42,`,
+			want:  `  42,`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.Formatted(tt.input); got != tt.want {
+				t.Errorf("Formatted(%q) =\n%q\nwant\n%q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlighter_Formatted_YAML(t *testing.T) {
+	h, err := NewHighlighter([]string{"msg", "timeout"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Mapping Value",
+			input: "msg: read timeout",
+			want:  "msg: read " + mark("timeout"),
+		},
+		{
+			name:  "Nested Sequence Value",
+			input: "  - msg: timeout",
+			want:  "  - msg: " + mark("timeout"),
+		},
+		{
+			name:  "Block Scalar Line",
+			input: "  msg timeout",
+			want:  "  " + mark("msg") + " " + mark("timeout"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.Formatted(tt.input); got != tt.want {
+				t.Errorf("Formatted(%q) =\n%q\nwant\n%q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHighlighter_InvalidPattern(t *testing.T) {
+	if _, err := NewHighlighter([]string{"ok", "("}, false); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestHighlightWriter_SplitWrites(t *testing.T) {
+	h, err := NewHighlighter([]string{"timeout"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	w := h.Writer(&out, false)
+	w.Write([]byte("time"))
+	w.Write([]byte("out one\ntimeout"))
+	w.Write([]byte(" two"))
+	w.Flush()
+
+	want := mark("timeout") + " one\n" + mark("timeout") + " two"
+	if got := out.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if strings.Count(out.String(), highlightOn) != 2 {
+		t.Errorf("expected matches split across writes to be highlighted once each")
+	}
+}
@@ -0,0 +1,92 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StrictExitCode is the exit status with --strict when the query failed on some lines.
+const StrictExitCode = 5
+
+// jqErrorReporter sits on jq's stderr and picks out the errors reported by the wrapped
+// query (see jqErrorDef). With --strict, query errors are printed with their line number;
+// otherwise they are only counted. Other stderr output goes on to out.
+type jqErrorReporter struct {
+	out    io.Writer
+	strict bool
+	buf    []byte
+
+	queryErrors int // lines the query failed on
+	parseErrors int // lines handed to jq that are not JSON (counted with --strict)
+}
+
+func newJqErrorReporter(out io.Writer, strict bool) *jqErrorReporter {
+	return &jqErrorReporter{out: out, strict: strict}
+}
+
+func (e *jqErrorReporter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	for {
+		idx := bytes.IndexByte(e.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		e.line(e.buf[:idx+1])
+		e.buf = e.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes out an unterminated last line.
+func (e *jqErrorReporter) Flush() {
+	if len(e.buf) > 0 {
+		e.line(e.buf)
+		e.buf = nil
+	}
+}
+
+func (e *jqErrorReporter) line(line []byte) {
+	report, ok := bytes.CutPrefix(bytes.TrimSuffix(line, []byte{'\n'}), []byte(jqErrorMarker))
+	var fields []json.RawMessage
+	if !ok || json.Unmarshal(report, &fields) != nil || len(fields) != 3 {
+		e.out.Write(line)
+		return
+	}
+	var kind string
+	var n int
+	json.Unmarshal(fields[0], &kind)
+	json.Unmarshal(fields[1], &n)
+	if kind == "parse" {
+		e.parseErrors++
+		return
+	}
+	e.queryErrors++
+	switch {
+	case e.strict && n > 0:
+		fmt.Fprintf(e.out, "[jqlogs] line %d: query error: %s\n", n, errorMessage(fields[2]))
+	case e.strict:
+		fmt.Fprintf(e.out, "[jqlogs] query error: %s\n", errorMessage(fields[2])) // not read from a line (e.g. --replay)
+	}
+}
+
+// Summary prints the number of errors, if any.
+func (e *jqErrorReporter) Summary() {
+	switch {
+	case e.strict && (e.queryErrors > 0 || e.parseErrors > 0):
+		fmt.Fprintf(e.out, "[jqlogs] %d query errors, %d lines starting with { or [ were not JSON\n", e.queryErrors, e.parseErrors)
+	case e.queryErrors > 0:
+		fmt.Fprintf(e.out, "[jqlogs] %d query errors, the original lines were printed instead (see them with --strict)\n", e.queryErrors)
+	}
+}
+
+// errorMessage returns the message of an error value: strings as they are, other values
+// (from error({...})) as JSON.
+func errorMessage(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	return string(v)
+}
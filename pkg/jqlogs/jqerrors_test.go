@@ -0,0 +1,64 @@
+package jqlogs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestJqErrorReporter(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+		input  string
+		want   string
+	}{
+		{
+			name:  "Other Output Passes Through",
+			input: "jq: error: something\nno newline",
+			want:  "jq: error: something\nno newline",
+		},
+		{
+			name:  "Query Errors Are Counted",
+			input: jqErrorMarker + `["query",null,"boom"]` + "\n" + jqErrorMarker + `["query",null,"boom"]` + "\n",
+			want:  "[jqlogs] 2 query errors, the original lines were printed instead (see them with --strict)\n",
+		},
+		{
+			name:  "Parse Errors Are Not Reported Without Strict",
+			input: jqErrorMarker + `["parse",null,"invalid"]` + "\n",
+			want:  "",
+		},
+		{
+			name:   "Strict",
+			strict: true,
+			input:  jqErrorMarker + `["query",7,"boom"]` + "\n" + jqErrorMarker + `["query",9,{"code":1}]` + "\n" + jqErrorMarker + `["parse",8,"invalid"]` + "\n",
+			want:   "[jqlogs] line 7: query error: boom\n[jqlogs] line 9: query error: {\"code\":1}\n[jqlogs] 2 query errors, 1 lines starting with { or [ were not JSON\n",
+		},
+		{
+			name:   "Strict Without Line Number",
+			strict: true,
+			input:  jqErrorMarker + `["query",null,"boom"]` + "\n",
+			want:   "[jqlogs] query error: boom\n[jqlogs] 1 query errors, 0 lines starting with { or [ were not JSON\n",
+		},
+		{
+			name:  "Malformed Report Passes Through",
+			input: jqErrorMarker + "oops\n",
+			want:  jqErrorMarker + "oops\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			e := newJqErrorReporter(&out, tt.strict)
+			// Written in small pieces, like a pipe may deliver it
+			for i := 0; i < len(tt.input); i += 5 {
+				e.Write([]byte(tt.input[i:min(i+5, len(tt.input))]))
+			}
+			e.Flush()
+			e.Summary()
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package jqlogs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxLineSize is the --max-line-size when not configured.
+const DefaultMaxLineSize = 1 << 20
+
+// What to do with lines longer than --max-line-size (--max-line-policy).
+const (
+	MaxLineTruncate = "truncate" // keep the first max bytes, followed by a marker
+	MaxLineSkip     = "skip"     // drop the line, with a warning
+	MaxLinePass     = "pass"     // keep the whole line, whatever its size
+)
+
+// lineReaderChunk is the size of the reads; lines are assembled from chunks.
+const lineReaderChunk = 64 * 1024
+
+var sizeRegexp = regexp.MustCompile(`^(\d+)\s*([KMG]?)(?:I?B)?$`)
+
+// ParseSize parses a byte size like "1048576", "512K", "4M" or "1GiB" (powers of 1024,
+// case-insensitive).
+func ParseSize(s string) (int, error) {
+	m := sizeRegexp.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("expects a size like 4M, got: %q", s)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expects a positive size, got: %q", s)
+	}
+	shift := map[string]int{"": 0, "K": 10, "M": 20, "G": 30}[m[2]]
+	if n > (1<<62)>>shift {
+		return 0, fmt.Errorf("size too large, got: %q", s)
+	}
+	return n << shift, nil
+}
+
+// ParseMaxLinePolicy validates a --max-line-policy value.
+func ParseMaxLinePolicy(s string) error {
+	switch s {
+	case MaxLineTruncate, MaxLineSkip, MaxLinePass:
+		return nil
+	}
+	return fmt.Errorf("requires %s, %s or %s, got: %q", MaxLineTruncate, MaxLineSkip, MaxLinePass, s)
+}
+
+// maxLineSize returns the --max-line-size, or the default.
+func (o JqFlagOptions) maxLineSize() int {
+	if o.MaxLineSize > 0 {
+		return o.MaxLineSize
+	}
+	return DefaultMaxLineSize
+}
+
+// maxLinePolicy returns the --max-line-policy, or the default.
+func (o JqFlagOptions) maxLinePolicy() string {
+	if o.MaxLinePolicy != "" {
+		return o.MaxLinePolicy
+	}
+	return MaxLineTruncate
+}
+
+// lineReader reads lines of any length. Unless they are passed through, only the first
+// max bytes of a line are kept in memory; the rest is read and counted, then dropped.
+type lineReader struct {
+	r    *bufio.Reader
+	max  int
+	pass bool
+	line []byte
+}
+
+func newLineReader(r io.Reader, max int, pass bool) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, lineReaderChunk), max: max, pass: pass}
+}
+
+// next returns the next line without its line ending, and the full size of the line,
+// which is larger than len(line) when the line was cut at max bytes. The line is only
+// valid until the next call. err is io.EOF after the last line.
+func (l *lineReader) next() (line []byte, size int, err error) {
+	l.line = l.line[:0]
+	var chunk []byte
+	var last byte // the byte before the current chunk
+	for {
+		if len(chunk) > 0 {
+			last = chunk[len(chunk)-1]
+		}
+		chunk, err = l.r.ReadSlice('\n')
+		size += len(chunk)
+		keep := chunk
+		if !l.pass {
+			keep = chunk[:min(len(chunk), max(l.max-len(l.line), 0))]
+		}
+		l.line = append(l.line, keep...)
+		if err != bufio.ErrBufferFull {
+			break
+		}
+	}
+	if err != nil && (err != io.EOF || size == 0) {
+		return nil, 0, err
+	}
+
+	// Drop the line ending, like bufio.ScanLines
+	if err == nil {
+		if len(chunk) > 1 {
+			last = chunk[len(chunk)-2]
+		}
+		size--
+		if last == '\r' && size > 0 {
+			size--
+		}
+	}
+	return l.line[:min(len(l.line), size)], size, nil
+}
+
+// formatSize prints a byte size the way ParseSize reads it, in the largest exact unit.
+func formatSize(n int) string {
+	for _, unit := range []struct {
+		suffix string
+		shift  int
+	}{{"G", 30}, {"M", 20}, {"K", 10}} {
+		if n >= 1<<unit.shift && n%(1<<unit.shift) == 0 {
+			return strconv.Itoa(n>>unit.shift) + unit.suffix
+		}
+	}
+	return strconv.Itoa(n)
+}
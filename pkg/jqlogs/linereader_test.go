@@ -0,0 +1,100 @@
+package jqlogs
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{input: "1048576", want: 1 << 20},
+		{input: "512K", want: 512 << 10},
+		{input: "4m", want: 4 << 20},
+		{input: "1GiB", want: 1 << 30},
+		{input: "2 MB", want: 2 << 20},
+		{input: "0", wantErr: true},
+		{input: "-1K", wantErr: true},
+		{input: "4T", wantErr: true},
+		{input: "huge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+			if !tt.wantErr {
+				if again, _ := ParseSize(formatSize(got)); again != got {
+					t.Errorf("formatSize(%d) = %q does not parse back", got, formatSize(got))
+				}
+			}
+		})
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", 3*lineReaderChunk)
+	input := "short\r\n" + long + "\n\n" + long + "\r\nlast"
+
+	type line struct {
+		text string
+		size int
+	}
+	tests := []struct {
+		name string
+		max  int
+		pass bool
+		want []line
+	}{
+		{
+			name: "Cut At Max",
+			max:  10,
+			want: []line{{"short", 5}, {"xxxxxxxxxx", len(long)}, {"", 0}, {"xxxxxxxxxx", len(long)}, {"last", 4}},
+		},
+		{
+			name: "Whole Lines Under Max",
+			max:  len(long),
+			want: []line{{"short", 5}, {long, len(long)}, {"", 0}, {long, len(long)}, {"last", 4}},
+		},
+		{
+			name: "Pass Through",
+			max:  10,
+			pass: true,
+			want: []line{{"short", 5}, {long, len(long)}, {"", 0}, {long, len(long)}, {"last", 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLineReader(strings.NewReader(input), tt.max, tt.pass)
+			var got []line
+			for {
+				text, size, err := r.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, line{string(text), size})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d = %.20q (%d bytes), want %.20q (%d bytes)", i, got[i].text, got[i].size, tt.want[i].text, tt.want[i].size)
+				}
+			}
+		})
+	}
+}
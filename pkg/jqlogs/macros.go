@@ -0,0 +1,227 @@
+package jqlogs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// macroNameRegexp matches a macro definition key: a name with an optional parameter list.
+var macroNameRegexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(?:\(\s*([A-Za-z_][A-Za-z0-9_]*(?:\s*[,;]\s*[A-Za-z_][A-Za-z0-9_]*)*)?\s*\))?$`)
+
+// jqFormats are jq's built-in @format strings; they are never treated as macros.
+var jqFormats = map[string]bool{
+	"text": true, "json": true, "html": true, "uri": true, "csv": true, "tsv": true,
+	"sh": true, "base64": true, "base64d": true, "base32": true, "base32d": true,
+}
+
+// maxMacroDepth bounds nested expansion, as a safety net next to cycle detection.
+const maxMacroDepth = 32
+
+// Macro is a named jq snippet from the config file, used in queries as @name or @name(args).
+type Macro struct {
+	Name   string
+	Params []string
+	Body   string
+}
+
+// Signature returns the macro as written in the config file, e.g. "slow(ms)".
+func (m Macro) Signature() string {
+	if len(m.Params) == 0 {
+		return m.Name
+	}
+	return m.Name + "(" + strings.Join(m.Params, ", ") + ")"
+}
+
+// ParseMacros parses macro definitions. Keys are "name" or "name(param, ...)";
+// parameters are referenced in the body as $param.
+func ParseMacros(defs map[string]string) (map[string]Macro, error) {
+	macros := make(map[string]Macro, len(defs))
+	for key, body := range defs {
+		m := macroNameRegexp.FindStringSubmatch(strings.TrimSpace(key))
+		if m == nil {
+			return nil, fmt.Errorf("invalid macro name %q (want name or name(param, ...))", key)
+		}
+		name := m[1]
+		if jqFormats[name] {
+			return nil, fmt.Errorf("macro @%s would shadow jq's @%s format", name, name)
+		}
+		if _, ok := macros[name]; ok {
+			return nil, fmt.Errorf("macro @%s is defined more than once", name)
+		}
+		var params []string
+		if m[2] != "" {
+			for _, p := range strings.FieldsFunc(m[2], func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+				params = append(params, p)
+			}
+		}
+		if strings.TrimSpace(body) == "" {
+			return nil, fmt.Errorf("macro @%s has an empty body", name)
+		}
+		macros[name] = Macro{Name: name, Params: params, Body: body}
+	}
+	return macros, nil
+}
+
+// SortedMacros returns the macros ordered by name.
+func SortedMacros(macros map[string]Macro) []Macro {
+	list := make([]Macro, 0, len(macros))
+	for _, m := range macros {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ExpandMacros replaces @name and @name(args) references in query by the macro bodies,
+// each wrapped in parentheses. Bodies and arguments may use other macros.
+// References inside string literals, jq @formats and .@field shorthands are left alone.
+func ExpandMacros(query string, macros map[string]Macro) (string, error) {
+	return expandMacros(query, macros, nil)
+}
+
+func expandMacros(query string, macros map[string]Macro, stack []string) (string, error) {
+	if !strings.Contains(query, "@") {
+		return query, nil
+	}
+	if len(stack) > maxMacroDepth {
+		return "", fmt.Errorf("macro expansion too deep: %s", strings.Join(stack, " -> "))
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		if c == '"' {
+			end := closingQuote(query, i)
+			if end < 0 {
+				end = len(query) - 1
+			}
+			b.WriteString(query[i : end+1])
+			i = end + 1
+			continue
+		}
+		if c != '@' || (i > 0 && isMacroNameChar(query[i-1], true)) || (i > 0 && query[i-1] == '.') {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+
+		// Read the name
+		j := i + 1
+		for j < len(query) && isMacroNameChar(query[j], j > i+1) {
+			j++
+		}
+		name := query[i+1 : j]
+		if name == "" || jqFormats[name] {
+			b.WriteString(query[i:j])
+			i = j
+			continue
+		}
+		macro, ok := macros[name]
+		if !ok {
+			return "", unknownMacroError(name, macros)
+		}
+
+		// Read the arguments
+		var args []string
+		if j < len(query) && query[j] == '(' {
+			end := matchingParen(query, j)
+			if end < 0 {
+				return "", fmt.Errorf("macro @%s: missing closing parenthesis", name)
+			}
+			args = splitMacroArgs(query[j+1 : end])
+			j = end + 1
+		}
+		if len(args) != len(macro.Params) {
+			return "", fmt.Errorf("macro @%s expects %d argument(s) (%s), got %d", name, len(macro.Params), macro.Signature(), len(args))
+		}
+
+		for _, frame := range stack {
+			if frame == name {
+				return "", fmt.Errorf("macro recursion: @%s -> @%s", strings.Join(stack, " -> @"), name)
+			}
+		}
+		body := macro.Body
+		for k, param := range macro.Params {
+			arg, err := expandMacros(args[k], macros, stack)
+			if err != nil {
+				return "", err
+			}
+			re := regexp.MustCompile(`\$` + regexp.QuoteMeta(param) + `\b`)
+			body = re.ReplaceAllLiteralString(body, "("+strings.TrimSpace(arg)+")")
+		}
+		expanded, err := expandMacros(body, macros, append(stack, name))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("(" + expanded + ")")
+		i = j
+	}
+	return b.String(), nil
+}
+
+func unknownMacroError(name string, macros map[string]Macro) error {
+	if len(macros) == 0 {
+		return fmt.Errorf("unknown macro @%s (no macros are defined; add them under \"macros\" in the config file)", name)
+	}
+	names := make([]string, 0, len(macros))
+	for _, m := range SortedMacros(macros) {
+		names = append(names, "@"+m.Name)
+	}
+	return fmt.Errorf("unknown macro @%s (available: %s)", name, strings.Join(names, ", "))
+}
+
+func isMacroNameChar(c byte, allowDigit bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (allowDigit && c >= '0' && c <= '9')
+}
+
+// matchingParen returns the index of the parenthesis closing the one at s[open], skipping strings.
+func matchingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			end := closingQuote(s, i)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitMacroArgs splits macro arguments on top-level commas or semicolons.
+func splitMacroArgs(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			if end := closingQuote(s, i); end >= 0 {
+				i = end
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',', ';':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, s[start:])
+}
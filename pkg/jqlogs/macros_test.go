@@ -0,0 +1,132 @@
+package jqlogs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandMacros(t *testing.T) {
+	macros, err := ParseMacros(map[string]string{
+		"errors":        `select(.level == "error")`,
+		"slow(ms)":      `select(.duration_ms > $ms)`,
+		"between(a, b)": `select(.n >= $a and .n < $b)`,
+		"slowerr(ms)":   `@errors | @slow($ms)`,
+		"loop":          `@loop2`,
+		"loop2":         `@loop`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "No Macros",
+			query: ".level .msg",
+			want:  ".level .msg",
+		},
+		{
+			name:  "Simple",
+			query: "@errors",
+			want:  `(select(.level == "error"))`,
+		},
+		{
+			name:  "Pipeline With Argument",
+			query: "@errors | @slow(500)",
+			want:  `(select(.level == "error")) | (select(.duration_ms > (500)))`,
+		},
+		{
+			name:  "Multiple Arguments",
+			query: "@between(1; 10)",
+			want:  `(select(.n >= (1) and .n < (10)))`,
+		},
+		{
+			name:  "Argument With Nested Parens",
+			query: "@slow(.limits | max(1, 2))",
+			want:  `(select(.duration_ms > (.limits | max(1, 2))))`,
+		},
+		{
+			name:  "Nested Macros",
+			query: "@slowerr(100)",
+			want:  `((select(.level == "error")) | (select(.duration_ms > ((100)))))`,
+		},
+		{
+			name:  "Formats, Strings and At Fields Are Untouched",
+			query: `.@timestamp, "user@example.com", (.msg | @base64), @csv "\(.a)"`,
+			want:  `.@timestamp, "user@example.com", (.msg | @base64), @csv "\(.a)"`,
+		},
+		{
+			name:    "Unknown Macro",
+			query:   "@nope",
+			wantErr: "unknown macro @nope (available: @between, @errors",
+		},
+		{
+			name:    "Wrong Argument Count",
+			query:   "@slow",
+			wantErr: "macro @slow expects 1 argument(s) (slow(ms)), got 0",
+		},
+		{
+			name:    "Missing Parenthesis",
+			query:   "@slow(5",
+			wantErr: "missing closing parenthesis",
+		},
+		{
+			name:    "Recursion",
+			query:   "@loop",
+			wantErr: "macro recursion: @loop -> @loop2 -> @loop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandMacros(tt.query, macros)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ExpandMacros(%q) error = %v, want %q", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandMacros(%q) unexpected error: %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("ExpandMacros(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandMacros_NoneDefined(t *testing.T) {
+	_, err := ExpandMacros("@errors", nil)
+	if err == nil || !strings.Contains(err.Error(), "no macros are defined") {
+		t.Errorf("ExpandMacros() error = %v, want hint about the config file", err)
+	}
+}
+
+func TestParseMacros_Invalid(t *testing.T) {
+	for _, defs := range []map[string]string{
+		{"bad name": "."},
+		{"csv": "."},
+		{"f(": "."},
+		{"empty": " "},
+		{"dup": ".", "dup(x)": "."},
+	} {
+		if _, err := ParseMacros(defs); err == nil {
+			t.Errorf("ParseMacros(%v) expected error", defs)
+		}
+	}
+}
+
+func TestMacro_Signature(t *testing.T) {
+	macros, err := ParseMacros(map[string]string{"between(a;b)": "."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := macros["between"].Signature(); got != "between(a, b)" {
+		t.Errorf("Signature() = %q, want %q", got, "between(a, b)")
+	}
+}
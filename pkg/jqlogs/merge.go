@@ -0,0 +1,407 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SourceField is the field added to a record for the pod (and container) or file it came
+// from, when several sources are merged (--from, --trace-id).
+const SourceField = "_source"
+
+// fileSourcePrefix marks a --from source that is a file rather than a pod.
+const fileSourcePrefix = "file:"
+
+// Defaults of the merge's reorder buffer.
+const (
+	// DefaultMergeBuffer is the number of records held for reordering when --merge-buffer is not given.
+	DefaultMergeBuffer = 10000
+	// DefaultMergeLateness is how long a record waits for the other sources when
+	// --merge-lateness is not given.
+	DefaultMergeLateness = 2 * time.Second
+)
+
+// merging reports whether the logs of several sources are merged (--from, --trace-id).
+func (o JqFlagOptions) merging() bool {
+	return len(o.From) > 0 || o.TraceID != ""
+}
+
+// mergeBuffer returns the --merge-buffer, or the default.
+func (o JqFlagOptions) mergeBuffer() int {
+	if o.MergeBuffer > 0 {
+		return o.MergeBuffer
+	}
+	return DefaultMergeBuffer
+}
+
+// mergeLateness returns the --merge-lateness, or the default.
+func (o JqFlagOptions) mergeLateness() time.Duration {
+	if o.MergeLateness > 0 {
+		return o.MergeLateness
+	}
+	return DefaultMergeLateness
+}
+
+// mergeSource is a source of merged logs: kubectl logs arguments, or a file.
+type mergeSource struct {
+	args     []string
+	file     string
+	selector bool // the logs of the pods of a label selector, which may start at any time
+}
+
+// mergeSources returns the sources given with --from: a pod or type/name, or a label
+// selector, read with the shared kubectl arguments, or a file (file:PATH). A pod or label
+// selector (-l) on the command line is a source of its own too, ahead of them. Without
+// --from, the shared arguments name the only source. kubectl prefixes lines with their pod
+// and container (--prefix).
+func mergeSources(kubectlArgs []string, from []string) []mergeSource {
+	if !slices.Contains(kubectlArgs, "--prefix") {
+		kubectlArgs = append(slices.Clone(kubectlArgs), "--prefix")
+	}
+	if len(from) == 0 {
+		return []mergeSource{{args: kubectlArgs}}
+	}
+	shared, pods, selectors := splitLogsResources(kubectlArgs)
+	sources := make([]mergeSource, 0, len(pods)+len(selectors)+len(from))
+	for _, pod := range pods {
+		sources = append(sources, mergeSource{args: append(slices.Clone(shared), pod)})
+	}
+	for _, selector := range selectors {
+		sources = append(sources, mergeSource{args: append(slices.Clone(shared), "-l", selector), selector: true})
+	}
+	for _, source := range from {
+		args := slices.Clone(shared)
+		switch {
+		case strings.HasPrefix(source, fileSourcePrefix):
+			sources = append(sources, mergeSource{file: strings.TrimPrefix(source, fileSourcePrefix)})
+		case isSelector(source):
+			sources = append(sources, mergeSource{args: append(args, "-l", source), selector: true})
+		default:
+			sources = append(sources, mergeSource{args: append(args, source)})
+		}
+	}
+	return sources
+}
+
+// splitLogsResources takes the pods and type/names, and the label selectors (-l), out of
+// kubectl logs arguments, so that each one can be read as a source of its own.
+func splitLogsResources(kubectlArgs []string) (shared, pods, selectors []string) {
+	for i := 0; i < len(kubectlArgs); i++ {
+		arg := kubectlArgs[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			pods = append(pods, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		tokens := []string{arg}
+		if !hasValue && (kubectlValueFlags[name] || kubectlConnectionFlags[name]) && i+1 < len(kubectlArgs) {
+			value = kubectlArgs[i+1]
+			tokens = append(tokens, value)
+			i++
+		}
+		if name == "-l" || name == "--selector" {
+			selectors = append(selectors, value)
+			continue
+		}
+		shared = append(shared, tokens...)
+	}
+	return shared, pods, selectors
+}
+
+// recordSource returns the SourceField of a record line, looking into unwrapped records.
+func recordSource(line []byte) string {
+	var record struct {
+		Source  string `json:"_source"`
+		Wrapped *struct {
+			Source string `json:"_source"`
+		} `json:"__jqlogs_record"`
+	}
+	json.Unmarshal(line, &record)
+	if record.Wrapped != nil {
+		return record.Wrapped.Source
+	}
+	return record.Source
+}
+
+// isSelector reports whether a --from source is a label selector (app=web, tier!=db,
+// env in (prod)) rather than a pod or type/name.
+func isSelector(source string) bool {
+	return strings.ContainsAny(source, "=!( ")
+}
+
+// cutSourcePrefix splits the "[pod/name/container] " prefix written by kubectl logs --prefix
+// from a line, returning "name/container" and the rest of the line.
+func cutSourcePrefix(line []byte) (string, []byte) {
+	if len(line) == 0 || line[0] != '[' {
+		return "", line
+	}
+	end := bytes.Index(line, []byte("] "))
+	if end < 0 {
+		return "", line
+	}
+	source, _ := strings.CutPrefix(string(line[1:end]), "pod/")
+	return source, line[end+2:]
+}
+
+// RunMerge streams the logs of several sources at once (--from) and prints their records
+// merged in timestamp order, each with its source as SourceField (text lines keep kubectl's
+// prefix). With --trace-id, only the records of that trace or request are kept. Each source
+// has its own stream filter, so --sample and --rate-limit apply per source. Returns exit code.
+func (r *Runner) RunMerge(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	sources := mergeSources(kubectlArgs, opts.From)
+	filters := make([]*streamFilter, len(sources))
+	for i, source := range sources {
+		filter, err := newStreamFilter(opts)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if source.file != "" {
+			filter.source = source.file
+		} else {
+			filter.prefixed = true
+		}
+		filters[i] = filter
+	}
+	var trace *traceMatcher
+	if opts.TraceID != "" {
+		trace = newTraceMatcher(opts.TraceID, opts.traceFields())
+	}
+
+	fields := opts.timeFields()
+	open := make([]bool, len(sources))
+	for i, source := range sources {
+		open[i] = source.selector
+	}
+	m := newMerger(open, opts.mergeBuffer(), opts.mergeLateness())
+	exitCode := r.process(jqQuery, opts, func(emit func(line []byte, number int, isJSON bool)) {
+		arrivals := make(chan mergeArrival, len(sources))
+		for i, source := range sources {
+			go func() {
+				defer func() { arrivals <- mergeArrival{stream: i, end: true} }()
+				add := func(line []byte, number int, isJSON bool) {
+					if trace != nil && !trace.match(line, isJSON) {
+						return
+					}
+					record := mergeRecord{line: bytes.Clone(line), number: number, isJSON: isJSON}
+					if isJSON {
+						record.time, _ = recordTime(line, fields)
+						record.source = recordSource(line)
+					} else {
+						record.source, _ = cutSourcePrefix(line)
+					}
+					arrivals <- mergeArrival{stream: i, record: record}
+				}
+				if source.file == "" {
+					r.stream(source.args, filters[i], add)
+					return
+				}
+				file, err := os.Open(source.file)
+				if err != nil {
+					fmt.Fprintf(r.Stderr, "Error: --from %v\n", err)
+					return
+				}
+				defer file.Close()
+				r.streamFrom(file, filters[i], add)
+			}()
+		}
+
+		// Records wait in the merger for the other sources, until their lateness expires
+		timer := time.NewTimer(time.Hour)
+		defer timer.Stop()
+		for live := len(sources); live > 0; {
+			var expired <-chan time.Time
+			if d, ok := m.wait(time.Now()); ok {
+				timer.Reset(d)
+				expired = timer.C
+			}
+			var records []mergeRecord
+			select {
+			case a := <-arrivals:
+				if a.end {
+					live--
+					records = m.end(a.stream, time.Now())
+				} else {
+					records = m.add(a.stream, a.record, time.Now())
+				}
+			case now := <-expired:
+				records = m.next(now)
+			}
+			for _, record := range records {
+				emit(record.line, record.number, record.isJSON)
+			}
+		}
+	})
+	m.report(r)
+	return exitCode
+}
+
+// mergeArrival is a record read from a source (the stream of a --from), or the end of the stream.
+type mergeArrival struct {
+	stream int
+	record mergeRecord
+	end    bool
+}
+
+// mergeRecord is a record waiting in the merge. Its time is zero when neither it nor the
+// records before it from the same source have a timestamp.
+type mergeRecord struct {
+	line    []byte
+	number  int    // line of the source it was read from
+	source  string // the pod and container of a prefixed stream (see SourceField)
+	isJSON  bool
+	time    time.Time
+	arrived time.Time
+}
+
+// merger orders the records of several sources, each in timestamp order, by their timestamp
+// (a k-way merge with a reorder buffer). A source is a pod and container of a stream (the
+// logs of a --from), since the stream of a label selector interleaves many pods. The earliest
+// record goes first once every source has one waiting, or its stream has ended; an open
+// stream (a label selector) may bring new pods until it ends. While following, a quiet source
+// holds the others back for at most lateness; then the records waiting go on, and the ones
+// that show up later with earlier timestamps are printed out of order. At most size records
+// are held.
+type merger struct {
+	size     int
+	lateness time.Duration
+
+	queues []*mergeQueue // in order of their first record
+	byKey  map[mergeKey]*mergeQueue
+	open   []bool // by stream
+	ended  []bool
+	held   int
+
+	printed time.Time // latest timestamp printed
+	late    int
+}
+
+// mergeKey identifies a source: a pod and container (or none) of a stream.
+type mergeKey struct {
+	stream int
+	source string
+}
+
+// mergeQueue holds the waiting records of a source.
+type mergeQueue struct {
+	stream  int
+	records []mergeRecord
+	last    time.Time // timestamp of the last timed record, inherited by lines without one
+}
+
+// newMerger creates a merger of len(open) streams; open ones may bring new sources until they end.
+func newMerger(open []bool, size int, lateness time.Duration) *merger {
+	return &merger{
+		size:     size,
+		lateness: lateness,
+		byKey:    make(map[mergeKey]*mergeQueue),
+		open:     open,
+		ended:    make([]bool, len(open)),
+	}
+}
+
+// add queues a record of a stream and returns the records ready to be printed, in order.
+// Records without a timestamp, like text lines, take the one of the record before them
+// from the same source.
+func (m *merger) add(stream int, r mergeRecord, now time.Time) []mergeRecord {
+	key := mergeKey{stream, r.source}
+	q, ok := m.byKey[key]
+	if !ok {
+		q = &mergeQueue{stream: stream}
+		m.byKey[key] = q
+		m.queues = append(m.queues, q)
+	}
+	if r.time.IsZero() {
+		r.time = q.last
+	} else {
+		q.last = r.time
+	}
+	r.arrived = now
+	q.records = append(q.records, r)
+	m.held++
+	return m.next(now)
+}
+
+// end marks the end of a stream and returns the records ready to be printed.
+func (m *merger) end(stream int, now time.Time) []mergeRecord {
+	m.ended[stream] = true
+	return m.next(now)
+}
+
+// next returns the records ready to be printed at now, in order.
+func (m *merger) next(now time.Time) []mergeRecord {
+	var ready []mergeRecord
+	for m.held > 0 {
+		// Streams that haven't sent anything yet, and open ones, may still bring earlier records
+		complete := true
+		started := make([]bool, len(m.ended))
+		for _, q := range m.queues {
+			started[q.stream] = true
+		}
+		for i, ended := range m.ended {
+			if !ended && (m.open[i] || !started[i]) {
+				complete = false
+			}
+		}
+
+		var earliest *mergeQueue
+		var oldest time.Time // arrival of the record waiting the longest
+		for _, q := range m.queues {
+			if len(q.records) == 0 {
+				complete = complete && m.ended[q.stream]
+				continue
+			}
+			if earliest == nil || q.records[0].time.Before(earliest.records[0].time) {
+				earliest = q
+			}
+			if oldest.IsZero() || q.records[0].arrived.Before(oldest) {
+				oldest = q.records[0].arrived
+			}
+		}
+		if !complete && m.held <= m.size && now.Sub(oldest) < m.lateness {
+			break
+		}
+
+		r := earliest.records[0]
+		earliest.records = earliest.records[1:]
+		m.held--
+		if r.time.Before(m.printed) {
+			m.late++
+		} else {
+			m.printed = r.time
+		}
+		ready = append(ready, r)
+	}
+	return ready
+}
+
+// wait returns how long until the lateness of the record waiting the longest expires,
+// if any record is waiting.
+func (m *merger) wait(now time.Time) (time.Duration, bool) {
+	var oldest time.Time
+	for _, q := range m.queues {
+		if len(q.records) > 0 && (oldest.IsZero() || q.records[0].arrived.Before(oldest)) {
+			oldest = q.records[0].arrived
+		}
+	}
+	if oldest.IsZero() {
+		return 0, false
+	}
+	return oldest.Add(m.lateness).Sub(now), true
+}
+
+// report prints the number of records printed out of timestamp order, if any.
+func (m *merger) report(r *Runner) {
+	if m.late > 0 {
+		fmt.Fprintf(r.Stderr, "[jqlogs] %d records printed out of timestamp order (see --merge-lateness and --merge-buffer)\n", m.late)
+	}
+}
@@ -0,0 +1,270 @@
+package jqlogs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeSources(t *testing.T) {
+	got := mergeSources([]string{"-n", "ns", "--since=1h"}, []string{"deploy/web", "app=api", "file:saved.log"})
+	want := []mergeSource{
+		{args: []string{"-n", "ns", "--since=1h", "--prefix", "deploy/web"}},
+		{args: []string{"-n", "ns", "--since=1h", "--prefix", "-l", "app=api"}, selector: true},
+		{file: "saved.log"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeSources() = %+v, want %+v", got, want)
+	}
+
+	// A pod or selector on the command line is a source of its own
+	got = mergeSources([]string{"-n", "ns", "pod-a", "-l", "app=web", "--tail", "5"}, []string{"pod-b"})
+	want = []mergeSource{
+		{args: []string{"-n", "ns", "--tail", "5", "--prefix", "pod-a"}},
+		{args: []string{"-n", "ns", "--tail", "5", "--prefix", "-l", "app=web"}, selector: true},
+		{args: []string{"-n", "ns", "--tail", "5", "--prefix", "pod-b"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeSources() = %+v, want %+v", got, want)
+	}
+
+	// Without --from, the command line names the only source
+	got = mergeSources([]string{"my-pod", "--prefix"}, nil)
+	if want := []mergeSource{{args: []string{"my-pod", "--prefix"}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeSources() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCutSourcePrefix(t *testing.T) {
+	tests := []struct {
+		line, wantSource, wantRest string
+	}{
+		{line: `[pod/web-1/app] {"msg":"hi"}`, wantSource: "web-1/app", wantRest: `{"msg":"hi"}`},
+		{line: "[pod/web-1/app] ", wantSource: "web-1/app", wantRest: ""},
+		{line: `{"msg":"hi"}`, wantRest: `{"msg":"hi"}`},
+		{line: "[INFO]", wantRest: "[INFO]"},
+	}
+	for _, tt := range tests {
+		source, rest := cutSourcePrefix([]byte(tt.line))
+		if source != tt.wantSource || string(rest) != tt.wantRest {
+			t.Errorf("cutSourcePrefix(%q) = %q, %q, want %q, %q", tt.line, source, rest, tt.wantSource, tt.wantRest)
+		}
+	}
+}
+
+func TestMerger(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+	at := func(line string, sec int) mergeRecord {
+		r := mergeRecord{line: []byte(line), isJSON: true}
+		if sec >= 0 {
+			r.time = base.Add(time.Duration(sec) * time.Second)
+		}
+		return r
+	}
+	lines := func(records []mergeRecord) []string {
+		var got []string
+		for _, r := range records {
+			got = append(got, string(r.line))
+		}
+		return got
+	}
+
+	// Each source in timestamp order, read to the end: a plain k-way merge
+	m := newMerger(make([]bool, 3), DefaultMergeBuffer, time.Minute)
+	var got []string
+	for _, a := range []struct {
+		stream int
+		record mergeRecord
+	}{
+		{0, at("a1", 1)}, {0, at("a4", 4)}, {1, at("b2", 2)}, {1, at("b-text", -1)},
+		{1, at("b3", 3)}, {0, at("a5", 5)}, {2, at("c0", 0)}, {2, at("c6", 6)},
+	} {
+		got = append(got, lines(m.add(a.stream, a.record, now))...)
+	}
+	for stream := range 3 {
+		got = append(got, lines(m.end(stream, now))...)
+	}
+	if want := []string{"c0", "a1", "b2", "b-text", "b3", "a4", "a5", "c6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+	if m.late != 0 {
+		t.Errorf("late = %d, want 0", m.late)
+	}
+
+	// A quiet source holds the records back until their lateness expires
+	m = newMerger(make([]bool, 2), DefaultMergeBuffer, 2*time.Second)
+	if ready := m.add(0, at("a1", 1), now); len(ready) != 0 {
+		t.Errorf("add() = %q, want the record held back", lines(ready))
+	}
+	if d, ok := m.wait(now.Add(500 * time.Millisecond)); !ok || d != 1500*time.Millisecond {
+		t.Errorf("wait() = %v, %v, want 1.5s", d, ok)
+	}
+	if ready := m.next(now.Add(2 * time.Second)); !reflect.DeepEqual(lines(ready), []string{"a1"}) {
+		t.Errorf("next(+2s) = %q, want a1", lines(ready))
+	}
+	if _, ok := m.wait(now); ok {
+		t.Error("wait() reported a record waiting, want none")
+	}
+	// The quiet source's earlier record shows up too late
+	if ready := m.add(1, at("b0", 0), now.Add(3*time.Second)); len(ready) != 0 {
+		t.Errorf("add() = %q, want the record held back", lines(ready))
+	}
+	if ready := m.add(0, at("a2", 2), now.Add(3*time.Second)); !reflect.DeepEqual(lines(ready), []string{"b0"}) || m.late != 1 {
+		t.Errorf("add() = %q, late = %d, want b0 printed late", lines(ready), m.late)
+	}
+	if ready := m.end(1, now.Add(3*time.Second)); !reflect.DeepEqual(lines(ready), []string{"a2"}) {
+		t.Errorf("end() = %q, want a2", lines(ready))
+	}
+
+	// The pods of a label selector are merged apart, and text lines take the time of their own pod
+	m = newMerger([]bool{true}, DefaultMergeBuffer, time.Minute)
+	got = nil
+	from := func(source string, r mergeRecord) mergeRecord {
+		r.source = source
+		return r
+	}
+	for _, r := range []mergeRecord{
+		from("web-1/app", at("w1-4", 4)), from("web-2/app", at("w2-1", 1)), from("web-1/app", at("w1-text", -1)),
+		from("web-2/app", at("w2-2", 2)), from("web-2/app", at("w2-text", -1)), from("web-1/app", at("w1-5", 5)),
+	} {
+		if ready := m.add(0, r, now); len(ready) != 0 {
+			t.Errorf("add() = %q, want the records held back until the selector ends", lines(ready))
+		}
+	}
+	got = lines(m.end(0, now))
+	if want := []string{"w2-1", "w2-2", "w2-text", "w1-4", "w1-text", "w1-5"}; !reflect.DeepEqual(got, want) || m.late != 0 {
+		t.Errorf("merged = %q, late = %d, want %q", got, m.late, want)
+	}
+
+	// At most size records are held
+	m = newMerger(make([]bool, 2), 2, time.Minute)
+	m.add(0, at("a1", 1), now)
+	m.add(0, at("a2", 2), now)
+	if ready := m.add(0, at("a3", 3), now); !reflect.DeepEqual(lines(ready), []string{"a1"}) {
+		t.Errorf("add() over the buffer size = %q, want a1", lines(ready))
+	}
+}
+
+func TestRunner_RunMerge(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+	logs := map[string]string{
+		"deploy/gateway": `[pod/gateway-1/app] {"ts":"2026-01-01T00:00:01Z","msg":"request","trace_id":"` + id + `"}` + "\n" +
+			`[pod/gateway-1/app] {"ts":"2026-01-01T00:00:02Z","msg":"other request","trace_id":"0af7651916cd43dd8448eb211c80319c"}` + "\n" +
+			`[pod/gateway-1/app] {"ts":"2026-01-01T00:00:09Z","msg":"response","trace_id":"` + id + `"}` + "\n",
+		"checkout-1": `[pod/checkout-1/app] {"ts":"2026-01-01T00:00:03Z","msg":"charge","traceparent":"00-` + id + `-00f067aa0ba902b7-01"}` + "\n" +
+			`[pod/checkout-1/app] retry for ` + id + "\n",
+	}
+	saved := filepath.Join(t.TempDir(), "worker.log")
+	os.WriteFile(saved, []byte(`{"ts":"2026-01-01T00:00:05Z","msg":"job","x-request-id":"`+id+`"}`+"\n"), 0o644)
+	var mu sync.Mutex
+	var gotArgs [][]string
+	var stdout lockedBuffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			mu.Lock()
+			gotArgs = append(gotArgs, args)
+			mu.Unlock()
+			io.WriteString(out, logs[args[len(args)-1]])
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	opts := JqFlagOptions{Raw: true, From: []string{"deploy/gateway", "checkout-1", "file:" + saved}, TraceID: id}
+	if exitCode := runner.RunMerge([]string{"-n", "ns"}, `"\(._source) \(.msg)"`, opts); exitCode != 0 {
+		t.Errorf("exit code = %d, want 0", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Text lines bypass jq, so only the records' order is compared
+	var records, text []string
+	for _, line := range strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n") {
+		if strings.HasPrefix(line, "[") {
+			text = append(text, line)
+		} else {
+			records = append(records, line)
+		}
+	}
+	if want := []string{"gateway-1/app request", "checkout-1/app charge", saved + " job", "gateway-1/app response"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q, want %q", records, want)
+	}
+	if want := []string{"[checkout-1/app] retry for " + id}; !reflect.DeepEqual(text, want) {
+		t.Errorf("text lines = %q, want %q", text, want)
+	}
+	slices.SortFunc(gotArgs, func(a, b []string) int { return strings.Compare(strings.Join(a, " "), strings.Join(b, " ")) })
+	if want := [][]string{{"-n", "ns", "--prefix", "checkout-1"}, {"-n", "ns", "--prefix", "deploy/gateway"}}; !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("kubectl args = %q, want %q", gotArgs, want)
+	}
+}
+
+func TestRunner_RunMerge_Selector(t *testing.T) {
+	// Two pods of one selector, interleaved: pretty-printed records are assembled per pod
+	logs := `[pod/web-2/app] {` + "\n" +
+		`[pod/web-1/app] {"ts":"2026-01-01T00:00:01Z","msg":"one"}` + "\n" +
+		`[pod/web-2/app]   "ts": "2026-01-01T00:00:02Z",` + "\n" +
+		`[pod/web-1/app] {"ts":"2026-01-01T00:00:04Z","msg":"four"}` + "\n" +
+		`[pod/web-2/app]   "msg": "two"` + "\n" +
+		`[pod/web-2/app] }` + "\n" +
+		`[pod/web-2/app] {"ts":"2026-01-01T00:00:03Z","msg":"three"}` + "\n" +
+		`[pod/web-1/app] {"ts":"2026-01-01T00:00:05Z","msg":"five"}` + "\n"
+	var stdout lockedBuffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			io.WriteString(out, logs)
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	opts := JqFlagOptions{Raw: true, From: []string{"app=web"}}
+	if exitCode := runner.RunMerge(nil, `"\(._source) \(.msg)"`, opts); exitCode != 0 {
+		t.Errorf("exit code = %d, want 0", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	got := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	want := []string{"web-1/app one", "web-2/app two", "web-2/app three", "web-1/app four", "web-1/app five"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+}
+
+func TestRunner_RunMerge_SelectorUnwrap(t *testing.T) {
+	// CRI partial chunks of two pods, interleaved, are joined per pod
+	logs := `[pod/web-1/app] 2026-01-01T00:00:01Z stdout P {"msg":` + "\n" +
+		`[pod/web-2/app] 2026-01-01T00:00:02Z stdout P {"msg":` + "\n" +
+		`[pod/web-1/app] 2026-01-01T00:00:01Z stdout F "one"}` + "\n" +
+		`[pod/web-2/app] 2026-01-01T00:00:02Z stdout F "two"}` + "\n"
+	var stdout lockedBuffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			io.WriteString(out, logs)
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	opts := JqFlagOptions{Raw: true, Unwrap: true, From: []string{"app=web"}}
+	if exitCode := runner.RunMerge(nil, `"\(._source) \(.msg)"`, opts); exitCode != 0 {
+		t.Errorf("exit code = %d, want 0", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	got := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if want := []string{"web-1/app one", "web-2/app two"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+}
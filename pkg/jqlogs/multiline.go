@@ -0,0 +1,175 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// DefaultMultilineMax is the number of lines a pretty-printed JSON record may span
+// when --multiline-max is not given.
+const DefaultMultilineMax = 500
+
+// multilineMax returns the --multiline-max, or the default; 0 with --no-multiline.
+func (o JqFlagOptions) multilineMax() int {
+	if o.NoMultiline {
+		return 0
+	}
+	if o.MultilineMax > 0 {
+		return o.MultilineMax
+	}
+	return DefaultMultilineMax
+}
+
+// multilineIdle is how long a pending record is held without new lines (e.g. while following)
+// before its lines are emitted as they came.
+var multilineIdle = time.Second
+
+// streamLine is a line on its way through the stream filter.
+type streamLine struct {
+	line     []byte
+	envelope map[string]any // set by --unwrap
+	text     bool           // known not to be JSON (e.g. truncated)
+	source   string         // the pod and container, from kubectl's --prefix (see RunMerge)
+	number   int            // line of the input it was read on (the first one of a joined record), for --strict
+}
+
+// jsonAssembler joins JSON values written across several lines, like pretty-printed
+// objects, into one line so that jq sees a whole record. A line that opens an object or
+// array without closing it, and is valid JSON as far as it goes, starts a record; the
+// following lines are held back until the brackets balance, then the record is emitted
+// compacted. As soon as the held lines can't be the start of a JSON value, or the record is
+// still open after maxLines lines, interrupted by another record, or at the end of the stream,
+// the held lines are emitted as they came.
+type jsonAssembler struct {
+	maxLines int
+	pending  []streamLine
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func newJSONAssembler(maxLines int) *jsonAssembler {
+	return &jsonAssembler{maxLines: maxLines}
+}
+
+// add passes a line to the assembler and returns the lines ready to go on, in order.
+// Returned lines are only valid until the next call.
+func (a *jsonAssembler) add(l streamLine) []streamLine {
+	if len(a.pending) == 0 {
+		if l.text || !opensJSON(l.line) {
+			return []streamLine{l}
+		}
+		a.depth, a.inString, a.escaped = 0, false, false
+		if a.scan(l.line); a.depth <= 0 {
+			return []streamLine{l} // a record on a single line, or not JSON at all
+		}
+		l.line = bytes.Clone(l.line)
+		a.pending = append(a.pending, l)
+		return nil
+	}
+
+	if l.text {
+		return append(a.flush(), l)
+	}
+	// A record starting at the first column is the next record: the pending one was never
+	// going to close. Nested values of a pretty-printed record are indented.
+	if isRecordLine(l.line) {
+		return append(a.flush(), a.add(l)...)
+	}
+	l.line = bytes.Clone(l.line)
+	a.pending = append(a.pending, l)
+	if a.scan(l.line); a.depth > 0 {
+		// Text after a stray "{" line is let go at once, not after maxLines lines or idling
+		if len(a.pending) >= a.maxLines || !isJSONPrefix(a.joined()) {
+			return a.flush()
+		}
+		return nil
+	}
+
+	// The brackets balance: the held lines make one record, if it is valid JSON
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, a.joined()); err != nil {
+		return a.flush()
+	}
+	record := streamLine{line: compact.Bytes(), envelope: a.pending[0].envelope, source: a.pending[0].source, number: a.pending[0].number}
+	a.pending = nil
+	return []streamLine{record}
+}
+
+// holding reports whether lines are held back for a pending record.
+func (a *jsonAssembler) holding() bool {
+	return len(a.pending) > 0
+}
+
+// joined returns the held lines, one after the other.
+func (a *jsonAssembler) joined() []byte {
+	var joined bytes.Buffer
+	for _, p := range a.pending {
+		joined.Write(p.line)
+		joined.WriteByte('\n')
+	}
+	return joined.Bytes()
+}
+
+// flush returns the held lines as they came, and forgets them.
+func (a *jsonAssembler) flush() []streamLine {
+	lines := a.pending
+	a.pending = nil
+	return lines
+}
+
+// scan tracks the bracket depth over line, outside of strings.
+func (a *jsonAssembler) scan(line []byte) {
+	for _, c := range line {
+		switch {
+		case a.escaped:
+			a.escaped = false
+		case a.inString:
+			if c == '\\' {
+				a.escaped = true
+			} else if c == '"' {
+				a.inString = false
+			}
+		case c == '"':
+			a.inString = true
+		case c == '{' || c == '[':
+			a.depth++
+		case c == '}' || c == ']':
+			a.depth--
+		}
+	}
+}
+
+// opensJSON reports whether line starts with { or [ but doesn't end with } or ], which
+// single-line records do, and is valid JSON up to its end, which text like
+// "[2026-10-18] GET /items?ids=[1,2" is not. Only those lines are scanned for an unclosed record.
+func opensJSON(line []byte) bool {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	last := trimmed[len(trimmed)-1]
+	if last == '}' || last == ']' {
+		return false
+	}
+	return isJSONPrefix(trimmed)
+}
+
+// isJSONPrefix reports whether b is valid JSON as far as it goes.
+func isJSONPrefix(b []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	for {
+		if _, err := dec.Token(); err != nil {
+			return err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// isRecordLine reports whether line starts a JSON record at the first column: a whole
+// object or array, or the opening line of one.
+func isRecordLine(line []byte) bool {
+	return len(line) > 0 && (line[0] == '{' || line[0] == '[') && (json.Valid(line) || opensJSON(line))
+}
@@ -0,0 +1,149 @@
+package jqlogs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONAssembler(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int
+		input    string
+		want     []string
+	}{
+		{
+			name:  "Single Line Records",
+			input: "{\"a\":1}\ntext\n[1,2]",
+			want:  []string{`{"a":1}`, "text", "[1,2]"},
+		},
+		{
+			name:  "Pretty Object",
+			input: "before\n{\n  \"msg\": \"a } in a string\",\n  \"nested\": {\"x\": [1,\n 2]}\n}\nafter",
+			want:  []string{"before", `{"msg":"a } in a string","nested":{"x":[1,2]}}`, "after"},
+		},
+		{
+			name:  "Pretty Array",
+			input: "[\n  {\"a\": 1},\n  {\"a\": 2}\n]",
+			want:  []string{`[{"a":1},{"a":2}]`},
+		},
+		{
+			name:  "Escaped Quote",
+			input: "{\n\"msg\": \"say \\\"{\\\"\"\n}",
+			want:  []string{`{"msg":"say \"{\""}`},
+		},
+		{
+			name:  "Invalid Record Falls Back",
+			input: "{\n  oops\n}\nnext",
+			want:  []string{"{", "  oops", "}", "next"},
+		},
+		{
+			name:     "Too Many Lines Falls Back",
+			maxLines: 3,
+			input:    "{\n\"a\": 1,\n\"b\": 2,\n\"c\": 3\n}",
+			want:     []string{"{", `"a": 1,`, `"b": 2,`, `"c": 3`, "}"},
+		},
+		{
+			name:  "Unclosed At End Falls Back",
+			input: "{ starting up\nready",
+			want:  []string{"{ starting up", "ready"},
+		},
+		{
+			name:  "Bracketed Text Is Not A Record",
+			input: "[2026-10-18] GET /items?ids=[1,2\n{\"a\":1}\n{\"a\":2}",
+			want:  []string{"[2026-10-18] GET /items?ids=[1,2", `{"a":1}`, `{"a":2}`},
+		},
+		{
+			name:  "Complete Record Ends The Pending One",
+			input: "{\"a\": [1,\n{\"b\":2}\n{\"c\":3}",
+			want:  []string{`{"a": [1,`, `{"b":2}`, `{"c":3}`},
+		},
+		{
+			name:  "Complete Record Starts A New One",
+			input: "{\"a\": [1,\n{\"b\":2}\n{\n\"c\": 3\n}",
+			want:  []string{`{"a": [1,`, `{"b":2}`, `{"c":3}`},
+		},
+		{
+			name:  "Indented Complete Value Stays In The Record",
+			input: "{\n  \"items\": [\n    {\"a\": 1}\n  ]\n}",
+			want:  []string{`{"items":[{"a":1}]}`},
+		},
+		{
+			name:  "Text Lines Are Not Assembled",
+			input: "{ not json [INFO]\n}",
+			want:  []string{"{ not json [INFO]", "}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxLines := tt.maxLines
+			if maxLines == 0 {
+				maxLines = DefaultMultilineMax
+			}
+			a := newJSONAssembler(maxLines)
+			var got []string
+			for _, line := range strings.Split(tt.input, "\n") {
+				for _, l := range a.add(streamLine{line: []byte(line)}) {
+					got = append(got, string(l.line))
+				}
+			}
+			for _, l := range a.flush() {
+				got = append(got, string(l.line))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONAssembler_LetsGo(t *testing.T) {
+	// Held lines go on as soon as they can't make a record, without waiting for more lines
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string // returned by the last add
+	}{
+		{name: "Text After A Stray Brace", lines: []string{"{", "server started"}, want: []string{"{", "server started"}},
+		{name: "Text After A Stray Bracket", lines: []string{"[", "  compiling"}, want: []string{"[", "  compiling"}},
+		{name: "Invalid After Valid Lines", lines: []string{"{", `  "a": 1,`, "  oops"}, want: []string{"{", `  "a": 1,`, "  oops"}},
+		{name: "Opening Record Starts A New One", lines: []string{`{"a": [1,`, "{"}, want: []string{`{"a": [1,`}},
+		{name: "Pretty Record Is Held", lines: []string{"{", `  "a": 1,`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newJSONAssembler(DefaultMultilineMax)
+			var got []string
+			for _, line := range tt.lines {
+				got = nil
+				for _, l := range a.add(streamLine{line: []byte(line)}) {
+					got = append(got, string(l.line))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("add() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONAssembler_Envelope(t *testing.T) {
+	a := newJSONAssembler(DefaultMultilineMax)
+	first := map[string]any{"stream": "stdout"}
+	a.add(streamLine{line: []byte("{"), envelope: first})
+	a.add(streamLine{line: []byte(`"a": 1`), envelope: map[string]any{"stream": "stdout", "n": 2}})
+	got := a.add(streamLine{line: []byte("}")})
+	if len(got) != 1 || string(got[0].line) != `{"a":1}` || !reflect.DeepEqual(got[0].envelope, first) {
+		t.Errorf("add() = %+v, want the record with the envelope of its first line", got)
+	}
+
+	// A line known not to be JSON breaks the pending record
+	a.add(streamLine{line: []byte("{")})
+	got = a.add(streamLine{line: []byte(`"a": "xxx [jqlogs: truncated 9 bytes]`), text: true})
+	if len(got) != 2 || !got[1].text {
+		t.Errorf("add() = %+v, want the held line and the text line", got)
+	}
+}
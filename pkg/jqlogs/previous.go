@@ -0,0 +1,223 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultContainerAnnotation names the container kubectl logs reads when --container is not given.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// kubectlValueFlags are the kubectl logs flags (and kubectl's global flags) taking a value,
+// so that the pod can be told apart from flag values.
+var kubectlValueFlags = map[string]bool{
+	"-c": true, "--container": true, "-l": true, "--selector": true,
+	"--tail": true, "--since": true, "--since-time": true, "--limit-bytes": true,
+	"--max-log-requests": true, "--pod-running-timeout": true,
+}
+
+// kubectlConnectionFlags select the cluster and namespace; they are passed on to kubectl get.
+var kubectlConnectionFlags = map[string]bool{
+	"-n": true, "--namespace": true, "--context": true, "--kubeconfig": true, "--cluster": true,
+	"--user": true, "--request-timeout": true, "-s": true, "--server": true, "--token": true,
+	"--as": true, "--as-group": true, "--as-uid": true, "--certificate-authority": true,
+	"--client-certificate": true, "--client-key": true, "--tls-server-name": true, "--cache-dir": true,
+}
+
+// podLogsArgs is a kubectl logs command line taken apart for --with-previous.
+type podLogsArgs struct {
+	pod       string
+	container string   // -c, or the deprecated second argument
+	all       bool     // --all-containers
+	logs      []string // the other flags, for kubectl logs
+	get       []string // the connection flags, for kubectl get
+}
+
+// parsePodLogsArgs takes apart the kubectl logs arguments of --with-previous, which reads
+// the logs of one pod.
+func parsePodLogsArgs(args []string) (podLogsArgs, error) {
+	var p podLogsArgs
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		tokens := []string{arg}
+		if !hasValue && (kubectlValueFlags[name] || kubectlConnectionFlags[name]) && i+1 < len(args) {
+			value = args[i+1]
+			tokens = append(tokens, value)
+			i++
+		}
+		switch {
+		case name == "-c" || name == "--container":
+			p.container = value
+		case name == "--all-containers":
+			p.all = true
+			if hasValue {
+				p.all, _ = strconv.ParseBool(value)
+			}
+		case name == "-p" || name == "--previous":
+			return p, fmt.Errorf("reads the previous logs itself, remove %s", name)
+		case name == "-l" || name == "--selector":
+			return p, fmt.Errorf("requires a pod, not a label selector")
+		case kubectlConnectionFlags[name] || name == "--insecure-skip-tls-verify":
+			p.get = append(p.get, tokens...)
+			p.logs = append(p.logs, tokens...)
+		default:
+			p.logs = append(p.logs, tokens...)
+		}
+	}
+
+	if len(positional) == 0 || len(positional) > 2 {
+		return p, fmt.Errorf("requires a pod")
+	}
+	p.pod = positional[0]
+	if kind, name, ok := strings.Cut(p.pod, "/"); ok {
+		if kind != "pod" && kind != "pods" && kind != "po" {
+			return p, fmt.Errorf("requires a pod, got: %q", p.pod)
+		}
+		p.pod = name
+	}
+	if len(positional) == 2 {
+		p.container = positional[1]
+	}
+	return p, nil
+}
+
+// podInfo is the part of a pod (kubectl get pod -o json) read by --with-previous.
+type podInfo struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Containers []struct {
+			Name string `json:"name"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		ContainerStatuses []containerStatus `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type containerStatus struct {
+	Name         string `json:"name"`
+	RestartCount int    `json:"restartCount"`
+	LastState    struct {
+		Terminated *struct {
+			Reason     string `json:"reason"`
+			ExitCode   int    `json:"exitCode"`
+			FinishedAt string `json:"finishedAt"`
+		} `json:"terminated"`
+	} `json:"lastState"`
+}
+
+// containers returns the containers to read: the one selected with -c, all of them with
+// --all-containers, else the one kubectl logs defaults to.
+func (p *podInfo) containers(args podLogsArgs) []string {
+	if args.container != "" {
+		return []string{args.container}
+	}
+	var names []string
+	for _, c := range p.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	if args.all || len(names) == 0 {
+		return names
+	}
+	if name := p.Metadata.Annotations[defaultContainerAnnotation]; name != "" {
+		return []string{name}
+	}
+	return names[:1]
+}
+
+// status returns the status of a container, if reported.
+func (p *podInfo) status(container string) (containerStatus, bool) {
+	for _, s := range p.Status.ContainerStatuses {
+		if s.Name == container {
+			return s, true
+		}
+	}
+	return containerStatus{}, false
+}
+
+// restartMarker is the line printed between the logs of a container's previous instance and
+// the current one.
+func restartMarker(s containerStatus) string {
+	var termination string
+	if t := s.LastState.Terminated; t != nil {
+		reason := t.Reason
+		if reason == "" {
+			reason = "unknown reason"
+		}
+		termination = fmt.Sprintf(", last terminated: %s (exit code %d)", reason, t.ExitCode)
+		if t.FinishedAt != "" {
+			termination += " at " + t.FinishedAt
+		}
+	}
+	return fmt.Sprintf("===== [jqlogs] %s restarted, restart count %d%s; current logs follow =====", s.Name, s.RestartCount, termination)
+}
+
+// RunWithPrevious prints the logs of the previous instance of each container of a pod, a
+// marker with its restart count and last termination, then the logs of the current instance
+// (--with-previous). The query runs over both. Containers that never restarted only have
+// their current logs. Returns exit code.
+func (r *Runner) RunWithPrevious(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	args, err := parsePodLogsArgs(kubectlArgs)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: --with-previous %v\n", err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	getArgs := append([]string{"pod", args.pod, "-o", "json"}, args.get...)
+	if err := r.ExecKubectlGet(getArgs, &out, r.Stderr); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: --with-previous reading pod %s: %v\n", args.pod, err)
+		return 1
+	}
+	var pod podInfo
+	if err := json.Unmarshal(out.Bytes(), &pod); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: --with-previous reading pod %s: %v\n", args.pod, err)
+		return 1
+	}
+	containers := pod.containers(args)
+	if len(containers) > 1 && isFollowing(kubectlArgs) {
+		fmt.Fprintf(r.Stderr, "Error: --with-previous follows a single container, select one of %s with --container\n", strings.Join(containers, ", "))
+		return 1
+	}
+
+	// Each stream gets its own jq run, so that the marker comes after all of the previous output
+	exitCode := 0
+	run := func(logsArgs []string) {
+		filter, err := newStreamFilter(opts)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+			exitCode = 1
+			return
+		}
+		code := r.process(jqQuery, opts, func(emit func(line []byte, number int, isJSON bool)) {
+			r.stream(logsArgs, filter, emit)
+		})
+		if exitCode == 0 {
+			exitCode = code
+		}
+	}
+	for _, container := range containers {
+		logsArgs := append(append([]string{}, args.logs...), args.pod, "-c", container)
+		if status, ok := pod.status(container); ok && status.LastState.Terminated != nil {
+			run(append(logsArgs, "--previous"))
+			fmt.Fprintln(r.Stdout, restartMarker(status))
+		}
+		run(logsArgs)
+	}
+	return exitCode
+}
@@ -0,0 +1,127 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePodLogsArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    podLogsArgs
+		wantErr bool
+	}{
+		{
+			name: "Pod With Flags",
+			args: []string{"-n", "ns", "--tail", "50", "my-pod", "-c", "app", "--context=prod", "--timestamps"},
+			want: podLogsArgs{
+				pod:       "my-pod",
+				container: "app",
+				logs:      []string{"-n", "ns", "--tail", "50", "--context=prod", "--timestamps"},
+				get:       []string{"-n", "ns", "--context=prod"},
+			},
+		},
+		{
+			name: "Type And Container Argument",
+			args: []string{"pod/my-pod", "sidecar", "--all-containers"},
+			want: podLogsArgs{pod: "my-pod", container: "sidecar", all: true},
+		},
+		{name: "Deployment", args: []string{"deploy/web"}, wantErr: true},
+		{name: "Selector", args: []string{"-l", "app=web"}, wantErr: true},
+		{name: "Previous Already", args: []string{"my-pod", "-p"}, wantErr: true},
+		{name: "No Pod", args: []string{"-n", "ns"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePodLogsArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePodLogsArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePodLogsArgs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testPod is a pod whose app container restarted after running out of memory
+const testPod = `{
+  "metadata": {"annotations": {"kubectl.kubernetes.io/default-container": "app"}},
+  "spec": {"containers": [{"name": "proxy"}, {"name": "app"}]},
+  "status": {"containerStatuses": [
+    {"name": "proxy", "restartCount": 0, "lastState": {}},
+    {"name": "app", "restartCount": 3, "lastState": {"terminated": {"reason": "OOMKilled", "exitCode": 137, "finishedAt": "2026-01-01T10:00:00Z"}}}
+  ]}
+}`
+
+func TestPodInfo_Containers(t *testing.T) {
+	var pod podInfo
+	if err := json.Unmarshal([]byte(testPod), &pod); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args podLogsArgs
+		want []string
+	}{
+		{args: podLogsArgs{}, want: []string{"app"}},
+		{args: podLogsArgs{container: "proxy"}, want: []string{"proxy"}},
+		{args: podLogsArgs{all: true}, want: []string{"proxy", "app"}},
+	}
+	for _, tt := range tests {
+		if got := pod.containers(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("containers(%+v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	status, _ := pod.status("app")
+	want := "===== [jqlogs] app restarted, restart count 3, last terminated: OOMKilled (exit code 137) at 2026-01-01T10:00:00Z; current logs follow ====="
+	if got := restartMarker(status); got != want {
+		t.Errorf("restartMarker() = %q, want %q", got, want)
+	}
+}
+
+func TestRunner_RunWithPrevious(t *testing.T) {
+	var getArgs []string
+	var stdout lockedBuffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			container := args[slices.Index(args, "-c")+1]
+			if slices.Contains(args, "--previous") {
+				io.WriteString(out, `{"msg":"`+container+` before"}`+"\n")
+			} else {
+				io.WriteString(out, `{"msg":"`+container+` after"}`+"\n")
+			}
+			return nil
+		},
+		ExecKubectlGet: func(args []string, out io.Writer, err io.Writer) error {
+			getArgs = args
+			io.WriteString(out, testPod)
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	if exitCode := runner.RunWithPrevious([]string{"-n", "ns", "my-pod", "--all-containers"}, ".msg", JqFlagOptions{Raw: true}); exitCode != 0 {
+		t.Errorf("exit code = %d, want 0", exitCode)
+	}
+	want := strings.Join([]string{
+		"proxy after",
+		"app before",
+		"===== [jqlogs] app restarted, restart count 3, last terminated: OOMKilled (exit code 137) at 2026-01-01T10:00:00Z; current logs follow =====",
+		"app after",
+	}, "\n") + "\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	if want := []string{"pod", "my-pod", "-o", "json", "-n", "ns"}; !reflect.DeepEqual(getArgs, want) {
+		t.Errorf("kubectl get args = %q, want %q", getArgs, want)
+	}
+}
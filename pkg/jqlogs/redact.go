@@ -0,0 +1,362 @@
+package jqlogs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redaction modes for --redact-mode
+const (
+	RedactMask = "mask" // replace with redactedText
+	RedactHash = "hash" // replace with a short keyed hash so equal values stay correlatable
+)
+
+const redactedText = "[REDACTED]"
+
+// redactHashKey keys the hashes of --redact-mode hash. It is random for each run, so that
+// values can be correlated within the output of a run, but not looked up in a dictionary
+// of hashed guesses (PINs, short tokens, emails).
+var redactHashKey = rand.Text()
+
+// Rule prefixes understood by --redact. Rules without a prefix are key names or glob paths.
+const (
+	redactPresetPrefix = "preset:"
+	redactRegexPrefix  = "re:"
+)
+
+// valueRule masks matching substrings of string values and plain text lines.
+type valueRule struct {
+	re *regexp.Regexp
+	// valid optionally rejects false positives among the matches (e.g. Luhn for card numbers)
+	valid func(string) bool
+}
+
+// redactPresets are the built-in rule sets, selected with --redact preset:<name>.
+var redactPresets = map[string]func() ([]string, []valueRule){
+	"email": func() ([]string, []valueRule) {
+		return nil, []valueRule{{re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)}}
+	},
+	"jwt": func() ([]string, []valueRule) {
+		return nil, []valueRule{{re: regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)}}
+	},
+	"credit-card": func() ([]string, []valueRule) {
+		return nil, []valueRule{{re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhnValid}}
+	},
+	"secrets": func() ([]string, []valueRule) {
+		return []string{
+			"password", "passwd", "secret", "*_secret", "token", "*_token", "api_key", "apikey",
+			"authorization", "cookie", "set-cookie", "private_key",
+		}, nil
+	},
+}
+
+func init() {
+	redactPresets["all"] = func() ([]string, []valueRule) {
+		var keys []string
+		var values []valueRule
+		for _, name := range RedactPresetNames() {
+			if name == "all" {
+				continue
+			}
+			k, v := redactPresets[name]()
+			keys = append(keys, k...)
+			values = append(values, v...)
+		}
+		return keys, values
+	}
+}
+
+// RedactPresetNames lists the built-in presets in alphabetical order.
+func RedactPresetNames() []string {
+	names := make([]string, 0, len(redactPresets))
+	for name := range redactPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Redactor masks sensitive data in log lines before they reach jq.
+type Redactor struct {
+	keys   [][]string // key/path patterns split into segments; anchored when keys[i][0] == ""
+	values []valueRule
+	mode   string
+	key    []byte // HMAC key of the hash mode
+}
+
+// NewRedactor compiles --redact rules. Each rule is one of:
+//   - preset:<name>  a built-in rule set (see RedactPresetNames)
+//   - re:<regexp>    a regular expression masked in string values and plain text lines
+//   - <path>         a key name or glob path whose whole value is masked; a leading dot
+//     anchors it at the record root (.headers.authorization), otherwise it matches at
+//     any depth (password, *.password). Keys are compared case-insensitively.
+func NewRedactor(rules []string, mode string) (*Redactor, error) {
+	if mode == "" {
+		mode = RedactMask
+	}
+	if mode != RedactMask && mode != RedactHash {
+		return nil, fmt.Errorf("unknown redact mode %q (want %s or %s)", mode, RedactMask, RedactHash)
+	}
+
+	r := &Redactor{mode: mode, key: []byte(redactHashKey)}
+	for _, rule := range rules {
+		switch {
+		case strings.HasPrefix(rule, redactPresetPrefix):
+			name := strings.TrimPrefix(rule, redactPresetPrefix)
+			preset, ok := redactPresets[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(RedactPresetNames(), ", "))
+			}
+			keys, values := preset()
+			for _, k := range keys {
+				r.addKey(k)
+			}
+			r.values = append(r.values, values...)
+		case strings.HasPrefix(rule, redactRegexPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(rule, redactRegexPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule %q: %w", rule, err)
+			}
+			r.values = append(r.values, valueRule{re: re})
+		default:
+			if err := r.addKey(rule); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *Redactor) addKey(rule string) error {
+	segments := strings.Split(strings.ToLower(rule), ".")
+	for _, s := range segments[1:] {
+		if s == "" {
+			return fmt.Errorf("invalid rule %q: empty path segment", rule)
+		}
+	}
+	for _, s := range segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return fmt.Errorf("invalid rule %q: %w", rule, err)
+		}
+	}
+	if len(segments) == 1 && segments[0] == "" {
+		return fmt.Errorf("invalid rule %q: empty path", rule)
+	}
+	r.keys = append(r.keys, segments)
+	return nil
+}
+
+// Line redacts one log line. JSON lines are decoded, redacted and re-encoded;
+// lines that are not valid JSON get the value patterns applied as plain text.
+// Lines without anything to redact are returned unchanged.
+func (r *Redactor) Line(line []byte, isJSON bool) []byte {
+	if isJSON {
+		if record, ok := decodeJSON(line); ok {
+			redacted, changed := r.value(record, nil)
+			if !changed {
+				return line
+			}
+			if b, ok := encodeJSON(redacted); ok {
+				return b
+			}
+			return line
+		}
+	}
+	text := string(line)
+	if redacted := r.Text(text); redacted != text {
+		return []byte(redacted)
+	}
+	return line
+}
+
+// Text applies the value patterns to a plain string.
+func (r *Redactor) Text(s string) string {
+	for _, rule := range r.values {
+		s = rule.re.ReplaceAllStringFunc(s, func(m string) string {
+			if rule.valid != nil && !rule.valid(m) {
+				return m
+			}
+			return r.replacement(m)
+		})
+	}
+	return s
+}
+
+// value redacts v, found at the given key path, and reports whether anything changed.
+func (r *Redactor) value(v any, keyPath []string) (any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		changed := false
+		for k, child := range v {
+			childPath := append(keyPath[:len(keyPath):len(keyPath)], strings.ToLower(k))
+			if r.matchesKey(childPath) {
+				v[k] = r.replacement(child)
+				changed = true
+				continue
+			}
+			if redacted, ok := r.value(child, childPath); ok {
+				v[k] = redacted
+				changed = true
+			}
+		}
+		return v, changed
+	case []any:
+		// Arrays are transparent to key paths: .users.password matches inside "users": [...]
+		changed := false
+		for i, child := range v {
+			if redacted, ok := r.value(child, keyPath); ok {
+				v[i] = redacted
+				changed = true
+			}
+		}
+		return v, changed
+	case string:
+		if redacted, ok := r.embedded(v, keyPath); ok {
+			return redacted, redacted != v
+		}
+		redacted := r.Text(v)
+		return redacted, redacted != v
+	}
+	return v, false
+}
+
+// embedded redacts a string holding a JSON object or array (an escaped payload, a sidecar's
+// "log" field) as if it were decoded at keyPath, so --parse-json or fromjson can't reveal
+// what it hides. ok is false when the string isn't such JSON.
+func (r *Redactor) embedded(s string, keyPath []string) (string, bool) {
+	trimmed := strings.TrimSpace(s)
+	if !startsJSON([]byte(trimmed)) {
+		return s, false
+	}
+	decoded, ok := decodeJSON([]byte(trimmed))
+	if !ok {
+		return s, false
+	}
+	redacted, changed := r.value(decoded, keyPath)
+	if !changed {
+		return s, true
+	}
+	b, ok := encodeJSON(redacted)
+	if !ok {
+		return s, false
+	}
+	start := strings.Index(s, trimmed)
+	return s[:start] + string(b) + s[start+len(trimmed):], true
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as they are written.
+func decodeJSON(b []byte) (any, bool) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+// encodeJSON encodes v on one line, without escaping HTML characters.
+func encodeJSON(v any) ([]byte, bool) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, false
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), true
+}
+
+// matchesKey reports whether the key path matches any key rule.
+func (r *Redactor) matchesKey(keyPath []string) bool {
+	for _, pattern := range r.keys {
+		anchored := pattern[0] == ""
+		if anchored {
+			pattern = pattern[1:]
+			if len(pattern) != len(keyPath) {
+				continue
+			}
+		} else if len(pattern) > len(keyPath) {
+			continue
+		}
+		tail := keyPath[len(keyPath)-len(pattern):]
+		matched := true
+		for i, seg := range pattern {
+			if ok, _ := path.Match(seg, tail[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// replacement returns what a redacted value is replaced with.
+func (r *Redactor) replacement(v any) string {
+	if r.mode != RedactHash {
+		return redactedText
+	}
+	s, ok := v.(string)
+	if !ok {
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// LoadRedactRules reads rules from a file, one per line.
+// Blank lines and lines starting with # are ignored.
+func LoadRedactRules(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rules = append(rules, line)
+	}
+	return rules, scanner.Err()
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum used by card numbers.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,193 @@
+package jqlogs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactor_Line(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []string
+		mode   string
+		input  string
+		isJSON bool
+		want   string
+	}{
+		{
+			name:   "Key At Any Depth",
+			rules:  []string{"password"},
+			input:  `{"user":{"name":"bob","Password":"hunter2"}}`,
+			isJSON: true,
+			want:   `{"user":{"Password":"[REDACTED]","name":"bob"}}`,
+		},
+		{
+			name:   "Anchored Path",
+			rules:  []string{".headers.authorization"},
+			input:  `{"headers":{"authorization":"Bearer x"},"authorization":"keep"}`,
+			isJSON: true,
+			want:   `{"authorization":"keep","headers":{"authorization":"[REDACTED]"}}`,
+		},
+		{
+			name:   "Glob Path",
+			rules:  []string{"*.password"},
+			input:  `{"password":"top","db":{"password":"nested"}}`,
+			isJSON: true,
+			want:   `{"db":{"password":"[REDACTED]"},"password":"top"}`,
+		},
+		{
+			name:   "Path Through Array",
+			rules:  []string{".users.token"},
+			input:  `{"users":[{"token":"a"},{"token":"b"}]}`,
+			isJSON: true,
+			want:   `{"users":[{"token":"[REDACTED]"},{"token":"[REDACTED]"}]}`,
+		},
+		{
+			name:   "Whole Object Value",
+			rules:  []string{"credentials"},
+			input:  `{"credentials":{"user":"u","pass":"p"}}`,
+			isJSON: true,
+			want:   `{"credentials":"[REDACTED]"}`,
+		},
+		{
+			name:   "Key In Embedded JSON",
+			rules:  []string{"password"},
+			input:  `{"payload":"{\"password\":\"hunter2\",\"n\":1.50}"}`,
+			isJSON: true,
+			want:   `{"payload":"{\"n\":1.50,\"password\":\"[REDACTED]\"}"}`,
+		},
+		{
+			name:   "Anchored Path Into Docker Log",
+			rules:  []string{".log.token"},
+			input:  `{"log":"{\"token\":\"abc\"}\n","stream":"stdout"}`,
+			isJSON: true,
+			want:   `{"log":"{\"token\":\"[REDACTED]\"}\n","stream":"stdout"}`,
+		},
+		{
+			name:   "Embedded JSON Without Secrets",
+			rules:  []string{"password"},
+			input:  `{"payload":"{ \"a\": 1 }"}`,
+			isJSON: true,
+			want:   `{"payload":"{ \"a\": 1 }"}`,
+		},
+		{
+			name:   "Email Preset In JSON",
+			rules:  []string{"preset:email"},
+			input:  `{"msg":"login by bob@example.com","n":12345678901234567890}`,
+			isJSON: true,
+			want:   `{"msg":"login by [REDACTED]","n":12345678901234567890}`,
+		},
+		{
+			name:  "Regex In Plain Text",
+			rules: []string{"re:id=\\d+"},
+			input: "user id=42 logged in",
+			want:  "user [REDACTED] logged in",
+		},
+		{
+			name:  "JWT Preset In Plain Text",
+			rules: []string{"preset:jwt"},
+			input: "token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig-_x end",
+			want:  "token [REDACTED] end",
+		},
+		{
+			name:  "Credit Card Preset Uses Luhn",
+			rules: []string{"preset:credit-card"},
+			input: "paid with 4111 1111 1111 1111, order 1234567890123",
+			want:  "paid with [REDACTED], order 1234567890123",
+		},
+		{
+			name:   "Hash Mode",
+			rules:  []string{"email"},
+			mode:   RedactHash,
+			input:  `{"email":"bob@example.com"}`,
+			isJSON: true,
+			want:   `{"email":"hmac:30f050000475"}`,
+		},
+		{
+			name:   "Unchanged Line Is Untouched",
+			rules:  []string{"password"},
+			input:  `{ "b": 1, "a": 2 }`,
+			isJSON: true,
+			want:   `{ "b": 1, "a": 2 }`,
+		},
+		{
+			name:   "Invalid JSON Falls Back To Text",
+			rules:  []string{"preset:email"},
+			input:  `{broken bob@example.com`,
+			isJSON: true,
+			want:   `{broken [REDACTED]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(tt.rules, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.key = []byte("test-key")
+			if got := string(r.Line([]byte(tt.input), tt.isJSON)); got != tt.want {
+				t.Errorf("Line(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_HashKey(t *testing.T) {
+	// Redactors of one run hash alike, with a key that is not empty
+	a, _ := NewRedactor([]string{"pin"}, RedactHash)
+	b, _ := NewRedactor([]string{"pin"}, RedactHash)
+	line := []byte(`{"pin":"1234"}`)
+	if got, want := string(a.Line(line, true)), string(b.Line(line, true)); got != want {
+		t.Errorf("redactors of one run hash differently: %q, %q", got, want)
+	}
+	if len(redactHashKey) < 16 {
+		t.Errorf("redactHashKey = %q, want a random key", redactHashKey)
+	}
+	if got := string(a.Line(line, true)); got == `{"pin":"hmac:5a697c6768fc"}` {
+		t.Errorf("hash with an empty key: %q", got)
+	}
+}
+
+func TestNewRedactor_Errors(t *testing.T) {
+	for _, rules := range [][]string{
+		{"preset:nope"},
+		{"re:("},
+		{"."},
+		{"a..b"},
+		{"[x"},
+	} {
+		if _, err := NewRedactor(rules, ""); err == nil {
+			t.Errorf("NewRedactor(%q) expected error", rules)
+		}
+	}
+	if _, err := NewRedactor(nil, "shred"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestLoadRedactRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules")
+	content := strings.Join([]string{
+		"# our rules",
+		"password",
+		"",
+		"  re:acct-\\d+  ",
+		"preset:jwt",
+	}, "\n")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LoadRedactRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"password", `re:acct-\d+`, "preset:jwt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadRedactRules() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+package jqlogs
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// replaySettle is how long the stream must be quiet before a query runs, so that
+	// the backlog sent by kubectl logs (e.g. --tail) is buffered first.
+	replaySettle = 200 * time.Millisecond
+	// replayMaxWait bounds that wait, for streams that never go quiet.
+	replayMaxWait = 3 * time.Second
+)
+
+const replayHelp = `Enter a jq query to run it over the buffered lines; an empty line re-runs the last one.
+Macros and Smart Query work as on the command line.
+  :info   show the buffer state
+  :help   show this help
+  :q      quit
+`
+
+// RunReplay buffers the stream (--replay) and reads queries from Stdin, running each one
+// over the buffered lines with the same output as Run. Following keeps appending to the
+// buffer meanwhile. Returns exit code.
+func (r *Runner) RunReplay(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	filter, err := newStreamFilter(opts)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	buffer := NewLineBuffer(opts.bufferSize())
+	if opts.BufferFile {
+		if buffer, err = NewFileLineBuffer(opts.bufferSize(), ""); err != nil {
+			fmt.Fprintf(r.Stderr, "Error: --buffer-file %v\n", err)
+			return 1
+		}
+	}
+	defer buffer.Close()
+
+	started := time.Now()
+	var lastAdd atomic.Int64
+	ended := make(chan struct{})
+	go func() {
+		defer close(ended)
+		var addErr error
+		r.stream(kubectlArgs, filter, func(line []byte, _ int, isJSON bool) {
+			if err := buffer.Add(line, isJSON); err != nil && addErr == nil {
+				addErr = err
+				fmt.Fprintf(r.Stderr, "Error: buffering log lines: %v\n", err)
+			}
+			lastAdd.Store(time.Now().UnixNano())
+		})
+	}()
+
+	// settled waits until the stream ended or went quiet, see replaySettle
+	settled := func() {
+		for {
+			select {
+			case <-ended:
+				return
+			default:
+			}
+			since := time.Since(started)
+			if last := lastAdd.Load(); last != 0 {
+				since = time.Since(time.Unix(0, last))
+			}
+			if since >= replaySettle && (lastAdd.Load() != 0 || since >= replayMaxWait) {
+				return
+			}
+			time.Sleep(replaySettle / 10)
+		}
+	}
+
+	fmt.Fprintf(r.Stderr, "[jqlogs] buffering the last %d lines; enter a jq query to run it over them (:help for help)\n", opts.bufferSize())
+	query := jqQuery
+	input := bufio.NewScanner(r.Stdin)
+	for {
+		fmt.Fprintf(r.Stderr, "jqlogs[%d]> ", buffer.Len())
+		if !input.Scan() {
+			fmt.Fprintln(r.Stderr)
+			return 0
+		}
+		line := strings.TrimSpace(input.Text())
+		switch line {
+		case ":q", ":quit":
+			return 0
+		case ":help":
+			fmt.Fprint(r.Stderr, replayHelp)
+			continue
+		case ":info":
+			state := "following"
+			select {
+			case <-ended:
+				state = "ended"
+			default:
+			}
+			fmt.Fprintf(r.Stderr, "[jqlogs] %d lines buffered of %d received, stream %s, last query: %s\n",
+				buffer.Len(), buffer.Added(), state, orDot(query))
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			fmt.Fprintf(r.Stderr, "[jqlogs] unknown command %s (:help for help)\n", line)
+			continue
+		}
+		if line != "" {
+			expanded, err := ExpandMacros(line, opts.macros)
+			if err == nil {
+				typed := opts
+				typed.typedQuery = line
+				err = ValidateQuery(expanded, typed)
+			}
+			if err != nil {
+				fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+				continue
+			}
+			query = expanded
+		}
+
+		settled()
+		replayed := 0
+		fed := make(chan struct{})
+		exitCode := r.process(query, opts, func(emit func(line []byte, number int, isJSON bool)) {
+			defer close(fed)
+			if err := buffer.Each(func(line []byte, isJSON bool) {
+				replayed++
+				emit(line, 0, isJSON)
+			}); err != nil {
+				fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+			}
+		})
+		<-fed
+		if exitCode != 0 {
+			fmt.Fprintf(r.Stderr, "[jqlogs] query failed (exit code %d)\n", exitCode)
+			continue
+		}
+		fmt.Fprintf(r.Stderr, "[jqlogs] %d lines replayed\n", replayed)
+	}
+}
+
+// orDot returns query, or "." for the default query.
+func orDot(query string) string {
+	if query == "" {
+		return "."
+	}
+	return query
+}
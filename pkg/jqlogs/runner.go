@@ -1,26 +1,35 @@
 package jqlogs
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/itchyny/gojq/cli"
 )
 
 // Runner manages the execution pipeline
 type Runner struct {
+	Stdin       io.Reader // queries entered with --replay
 	Stdout      io.Writer
 	Stderr      io.Writer
 	ExecKubectl func(args []string, stdout io.Writer, stderr io.Writer) error
-	ExecJq      func(args []string, stdin io.Reader) int
+	// ExecKubectlGet runs kubectl get, to look up the pod (--with-previous)
+	ExecKubectlGet func(args []string, stdout io.Writer, stderr io.Writer) error
+	ExecJq         func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int
 }
 
 // NewDefaultRunner creates a runner with real dependencies
 func NewDefaultRunner() *Runner {
 	return &Runner{
+		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 		ExecKubectl: func(args []string, stdout io.Writer, stderr io.Writer) error {
@@ -33,13 +42,24 @@ func NewDefaultRunner() *Runner {
 			}
 			return cmd.Wait()
 		},
-		ExecJq: func(args []string, stdin io.Reader) int {
+		ExecKubectlGet: func(args []string, stdout io.Writer, stderr io.Writer) error {
+			cmd := exec.Command("kubectl", append([]string{"get"}, args...)...)
+			cmd.Env = os.Environ()
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+			return cmd.Run()
+		},
+		ExecJq: func(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
 			// Save originals
 			oldArgs := os.Args
 			oldStdin := os.Stdin
+			oldStdout := os.Stdout
+			oldStderr := os.Stderr
 			defer func() {
 				os.Args = oldArgs
 				os.Stdin = oldStdin
+				os.Stdout = oldStdout
+				os.Stderr = oldStderr
 			}()
 
 			os.Args = args
@@ -49,28 +69,223 @@ func NewDefaultRunner() *Runner {
 			if f, ok := stdin.(*os.File); ok {
 				os.Stdin = f
 			}
-			return cli.Run()
+
+			// gojq always prints to os.Stdout and os.Stderr. Any other writer (e.g. one that
+			// post-processes the output) is fed through a pipe that is drained before returning.
+			var drains []func()
+			for _, s := range []struct {
+				file **os.File
+				w    io.Writer
+			}{{&os.Stdout, stdout}, {&os.Stderr, stderr}} {
+				if f, ok := s.w.(*os.File); ok {
+					*s.file = f
+					continue
+				}
+				pr, pw, err := os.Pipe()
+				if err != nil {
+					fmt.Fprintf(oldStderr, "Error creating pipe: %v\n", err)
+					return 1
+				}
+				copied := make(chan struct{})
+				go func(w io.Writer) {
+					defer close(copied)
+					io.Copy(w, pr)
+				}(s.w)
+				*s.file = pw
+				drains = append(drains, func() {
+					pw.Close()
+					<-copied
+				})
+			}
+			exitCode := cli.Run()
+			for _, drain := range drains {
+				drain()
+			}
+			return exitCode
 		},
 	}
 }
 
 // Run executes the kubectl -> stream filter -> jq logs pipeline. Returns exit code.
 func (r *Runner) Run(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
-	// Pipe between kubectl and our Scanner
-	kPr, kPw, err := os.Pipe()
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	filter, err := newStreamFilter(opts)
 	if err != nil {
-		fmt.Fprintf(r.Stderr, "Error creating pipe: %v\n", err)
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
 		return 1
 	}
+	return r.process(jqQuery, opts, func(emit func(line []byte, number int, isJSON bool)) {
+		r.stream(kubectlArgs, filter, emit)
+	})
+}
 
+// process runs jq over the lines passed by feed to emit: JSON lines go through jq,
+// the others are printed as they are. Returns jq's exit code.
+func (r *Runner) process(jqQuery string, opts JqFlagOptions, feed func(emit func(line []byte, number int, isJSON bool))) int {
 	// Pipe between our Scanner and JQ
 	jqPr, jqPw, err := os.Pipe()
 	if err != nil {
 		fmt.Fprintf(r.Stderr, "Error creating pipe: %v\n", err)
 		return 1
 	}
+	defer jqPr.Close()
+
+	// Output writers for lines bypassing jq and for jq's own output.
+	// With --highlight, both are wrapped to mark matches (only on a terminal, unless -C forces color).
+	textOut, jqOut := r.Stdout, r.Stdout
+	var flushText, flushJq func() error
+	if len(opts.Highlight) > 0 && !opts.Monochrome && (opts.Color || isTerminal(r.Stdout)) {
+		h, err := NewHighlighter(opts.Highlight, opts.Yaml)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "Error: --highlight %v\n", err)
+			return 1
+		}
+		textWriter, jqWriter := h.Writer(r.Stdout, false), h.Writer(r.Stdout, true)
+		textOut, jqOut = textWriter, jqWriter
+		flushText, flushJq = textWriter.Flush, jqWriter.Flush
+		// jq now writes to the highlighter, not the terminal, so it would turn its colors off
+		opts.Color = true
+	}
+
+	// 1. Feed the lines asynchronously
+	go func() {
+		defer jqPw.Close() // closing this tells JQ we are done sending JSON
+		if flushText != nil {
+			defer flushText()
+		}
+		feed(func(line []byte, number int, isJSON bool) {
+			if isJSON {
+				// Send to JQ pipe; with --strict, numbered for error messages (see jqNumberedInputDef)
+				if opts.Strict && number > 0 {
+					fmt.Fprintf(jqPw, "\x1e%d\t", number)
+				}
+				jqPw.Write(line)
+				jqPw.Write([]byte{'\n'})
+			} else {
+				// Bypass JQ, print directly to Stdout.
+				textOut.Write(line)
+				textOut.Write([]byte{'\n'})
+			}
+		})
+	}()
+
+	// 2. Run JQ synchronously
+	jqArgs := BuildJqArgs(jqQuery, opts)
+	jqErrors := newJqErrorReporter(r.Stderr, opts.Strict)
+	exitCode := r.ExecJq(jqArgs, jqPr, jqOut, jqErrors)
+	if flushJq != nil {
+		flushJq()
+	}
+	jqErrors.Flush()
+	jqErrors.Summary()
+	if exitCode == 0 && opts.Strict && jqErrors.queryErrors > 0 {
+		exitCode = StrictExitCode
+	}
+	return exitCode
+}
+
+// reportDropped prints a notice about lines dropped by --rate-limit.
+func (r *Runner) reportDropped(n int) {
+	if n > 0 {
+		fmt.Fprintf(r.Stderr, "[jqlogs] %d lines dropped by --rate-limit\n", n)
+	}
+}
+
+// streamFilter holds the per-stream stages between kubectl and jq:
+// the line size limit, envelope unwrapping, multi-line records, sampling, rate limiting
+// and redaction.
+type streamFilter struct {
+	mu            sync.Mutex // the stages run for each line read, and from timers
+	dropTimer     *time.Timer
+	prefixed      bool   // lines start with kubectl's --prefix, see RunMerge
+	source        string // the source of all the lines, when not prefixed
+	maxLineSize   int
+	maxLinePolicy string
+	multilineMax  int
+	unwrapper     *Unwrapper            // with --unwrap; when prefixed, only its settings are used
+	unwrappers    map[string]*Unwrapper // by source, when prefixed
+	sampler       *Sampler
+	limiter       *RateLimiter
+	redactor      *Redactor
+}
+
+// newStreamFilter builds the stream filter stages enabled in opts.
+func newStreamFilter(opts JqFlagOptions) (*streamFilter, error) {
+	f := &streamFilter{
+		maxLineSize:   opts.maxLineSize(),
+		maxLinePolicy: opts.maxLinePolicy(),
+		multilineMax:  opts.multilineMax(),
+	}
+	if opts.Unwrap {
+		// Lines assembled from partial chunks are cut at the size limit, like the lines read
+		limit := f.maxLineSize
+		if f.maxLinePolicy == MaxLinePass {
+			limit = 0
+		}
+		f.unwrapper = NewUnwrapper(limit)
+	}
+	if opts.Sample.Enabled() {
+		f.sampler = NewSampler(opts.Sample, opts.SampleKey)
+	}
+	if opts.RateLimit.Enabled() {
+		f.limiter = NewRateLimiter(opts.RateLimit)
+	}
+	if len(opts.Redact) > 0 {
+		redactor, err := NewRedactor(opts.Redact, opts.RedactMode)
+		if err != nil {
+			return nil, fmt.Errorf("--redact %w", err)
+		}
+		f.redactor = redactor
+	}
+	return f, nil
+}
+
+// unwrapperOf returns the unwrapper for the lines of source, or nil without --unwrap. In a
+// prefixed stream each source has its own, so that the partial lines of pods don't mix.
+func (f *streamFilter) unwrapperOf(source string) *Unwrapper {
+	if f.unwrapper == nil || !f.prefixed {
+		return f.unwrapper
+	}
+	u, ok := f.unwrappers[source]
+	if !ok {
+		if f.unwrappers == nil {
+			f.unwrappers = make(map[string]*Unwrapper)
+		}
+		u = NewUnwrapper(f.unwrapper.max)
+		f.unwrappers[source] = u
+	}
+	return u
+}
+
+// reportDroppedLater reports the lines dropped by --rate-limit when the current window ends,
+// so that a burst is reported even when no line follows it.
+func (f *streamFilter) reportDroppedLater(r *Runner) {
+	if f.dropTimer != nil {
+		return
+	}
+	f.dropTimer = time.AfterFunc(f.limiter.Remaining(), func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.dropTimer = nil
+		r.reportDropped(f.limiter.Flush())
+	})
+}
+
+// stream runs kubectl and passes every line that gets through the filter to emit,
+// flagging the ones to hand to jq. It returns when kubectl's output ends.
+// The line is only valid during the call.
+func (r *Runner) stream(kubectlArgs []string, f *streamFilter, emit func(line []byte, number int, isJSON bool)) {
+	// Pipe between kubectl and our line reader
+	kPr, kPw, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error creating pipe: %v\n", err)
+		return
+	}
+	defer kPr.Close()
 
-	// 1. Start kubectl asynchronously
 	go func() {
 		defer kPw.Close()
 		err := r.ExecKubectl(kubectlArgs, kPw, r.Stderr)
@@ -80,51 +295,169 @@ func (r *Runner) Run(kubectlArgs []string, jqQuery string, opts JqFlagOptions) i
 		}
 	}()
 
-	// 2. Start Scanner (Filter) asynchronously
-	go func() {
-		defer jqPw.Close() // closing this tells JQ we are done sending JSON
-		scanner := bufio.NewScanner(kPr)
+	r.streamFrom(kPr, f, emit)
+}
 
-		// To handle very long lines, allow up to 1MB line buffer
-		buf := make([]byte, 0, 64*1024)
-		scanner.Buffer(buf, 1024*1024)
+// streamFrom passes the lines of in that get through the filter to emit, like stream.
+func (r *Runner) streamFrom(in io.Reader, f *streamFilter, emit func(line []byte, number int, isJSON bool)) {
+	// Lines of any length are read; the ones over --max-line-size follow --max-line-policy
+	maxSize, policy := f.maxLineSize, f.maxLinePolicy
+	reader := newLineReader(in, maxSize, policy == MaxLinePass)
+	// Pretty-printed JSON records are joined into one line, apart for each source, since the
+	// lines of the pods of a prefixed stream are interleaved
+	assemblers := make(map[string]*jsonAssembler)
+	flush := func() {
+		for _, source := range slices.Sorted(maps.Keys(assemblers)) {
+			for _, l := range assemblers[source].flush() {
+				r.filterLine(f, l, emit)
+			}
+		}
+	}
 
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(line) == 0 {
-				fmt.Fprintln(r.Stdout)
-				continue
+	if f.limiter != nil {
+		defer func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.dropTimer != nil {
+				f.dropTimer.Stop()
+				f.dropTimer = nil
 			}
+			r.reportDropped(f.limiter.Flush())
+		}()
+	}
 
-			// Pre-filter logic: skip leading whitespaces to find first char
-			isJSON := false
-			for _, b := range line {
-				if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
-					continue
+	// A pending record is given up on when the stream goes quiet, so that following
+	// doesn't hold back the lines of a record that never closes
+	var idle *time.Timer
+	flushIdle := func() {
+		if idle != nil {
+			idle.Reset(multilineIdle)
+			return
+		}
+		idle = time.AfterFunc(multilineIdle, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			flush()
+		})
+	}
+
+	handle := func(line []byte, size, number int) {
+		source := f.source
+		if f.prefixed {
+			source, line = cutSourcePrefix(line)
+		}
+		line, truncated, ok := r.limitLine(f, line, size)
+		if !ok {
+			return
+		}
+
+		// Replace container runtime / log shipper envelopes by the application payload
+		var envelope map[string]any
+		if unwrapper := f.unwrapperOf(source); unwrapper != nil {
+			if payload, size, env, ok := unwrapper.Unwrap(line); ok {
+				if payload == nil {
+					return // partial chunk, wait for the rest of the line
 				}
-				if b == '{' || b == '[' {
-					isJSON = true
+				// A line assembled from partial chunks follows --max-line-policy too
+				if payload, truncated, ok = r.limitLine(f, payload, size); !ok {
+					return
 				}
-				break
+				line, envelope = payload, env
 			}
+		}
 
-			if isJSON {
-				// Send to JQ pipe
-				jqPw.Write(line)
-				jqPw.Write([]byte{'\n'})
-			} else {
-				// Bypass JQ, print directly to Stdout.
-				r.Stdout.Write(line)
-				r.Stdout.Write([]byte{'\n'})
+		l := streamLine{line: line, envelope: envelope, text: truncated, source: source, number: number}
+		if f.multilineMax == 0 {
+			r.filterLine(f, l, emit)
+			return
+		}
+		assembler, ok := assemblers[source]
+		if !ok {
+			assembler = newJSONAssembler(f.multilineMax)
+			assemblers[source] = assembler
+		}
+		for _, l := range assembler.add(l) {
+			r.filterLine(f, l, emit)
+		}
+		if assembler.holding() {
+			flushIdle()
+		}
+	}
+	for number := 1; ; number++ {
+		line, size, err := reader.next()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(r.Stderr, "Error reading log stream: %v\n", err)
 			}
+			break
 		}
+		f.mu.Lock()
+		handle(line, size, number)
+		f.mu.Unlock()
+	}
+	f.mu.Lock()
+	if idle != nil {
+		idle.Stop()
+	}
+	flush()
+	f.mu.Unlock()
+}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Fprintf(r.Stderr, "Error reading log stream: %v\n", err)
+// limitLine applies --max-line-policy to a line of size bytes, of which line holds the first
+// --max-line-size bytes when it is larger. It reports whether the line was truncated, and
+// false when the line is skipped.
+func (r *Runner) limitLine(f *streamFilter, line []byte, size int) ([]byte, bool, bool) {
+	maxSize, policy := f.maxLineSize, f.maxLinePolicy
+	if size <= maxSize || policy == MaxLinePass {
+		return line, false, true
+	}
+	if policy == MaxLineSkip {
+		fmt.Fprintf(r.Stderr, "[jqlogs] skipped a line of %d bytes (over --max-line-size %s)\n", size, formatSize(maxSize))
+		return nil, false, false
+	}
+	return fmt.Appendf(line, " [jqlogs: truncated %d bytes]", size-maxSize), true, true
+}
+
+// filterLine passes the records of a line through the per-record stages of the stream
+// filter to emit.
+func (r *Runner) filterLine(f *streamFilter, l streamLine, emit func(line []byte, number int, isJSON bool)) {
+	for _, record := range splitJSONValues(l) {
+		r.filterRecord(f, record, emit)
+	}
+}
+
+func (r *Runner) filterRecord(f *streamFilter, l streamLine, emit func(line []byte, number int, isJSON bool)) {
+	line := l.line
+	// Pre-filter logic: lines starting with { or [ (after whitespace) go to jq,
+	// unless they are known not to be JSON (e.g. truncated)
+	isJSON := startsJSON(line) && !l.text
+
+	if f.sampler != nil && !f.sampler.Keep(line, isJSON) {
+		return
+	}
+	if f.limiter != nil {
+		ok, dropped := f.limiter.Allow()
+		r.reportDropped(dropped)
+		if !ok {
+			f.reportDroppedLater(r)
+			return
 		}
-	}()
+	}
+	// Redact before jq sees the record, so user queries can't reveal masked values
+	if f.redactor != nil {
+		line = f.redactor.Line(line, isJSON)
+	}
+	// Records show their source as SourceField, text lines keep kubectl's prefix
+	if l.source != "" {
+		if isJSON && bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) && json.Valid(line) {
+			line = withField(bytes.TrimSpace(line), SourceField, l.source)
+		} else {
+			line, isJSON = append([]byte("["+l.source+"] "), line...), false
+		}
+	}
 
-	// 3. Run JQ synchronously
-	jqArgs := BuildJqArgs(jqQuery, opts)
-	return r.ExecJq(jqArgs, jqPr)
+	if isJSON && l.envelope != nil && json.Valid(line) {
+		line = wrapEnveloped(line, l.envelope)
+	}
+	emit(line, l.number, isJSON)
 }
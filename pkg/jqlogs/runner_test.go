@@ -2,8 +2,12 @@ package jqlogs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -21,7 +25,7 @@ func TestRunner_Run_Success(t *testing.T) {
 			return nil
 		},
 		// Mock ExecJq
-		ExecJq: func(args []string, stdin io.Reader) int {
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
 			data, _ := io.ReadAll(stdin)
 			// In our mock, jq just capitalizes the input to prove it ran
 			stdout.Write([]byte(strings.ToUpper(string(data))))
@@ -76,7 +80,7 @@ func TestRunner_Run_Filtering(t *testing.T) {
 			out.Write([]byte("plain text log 2\n"))
 			return nil
 		},
-		ExecJq: func(args []string, stdin io.Reader) int {
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
 			// Read from passed stdin (which should only contain JSON lines now)
 			// We copy it to stdout with a prefix to indicate JQ processed it
 
@@ -129,3 +133,667 @@ func TestRunner_Run_Filtering(t *testing.T) {
 		t.Errorf("Missing JQ processed array. Output: %s", outStr)
 	}
 }
+
+func TestRunner_Run_RateLimit(t *testing.T) {
+	var stdout, stderr lockedBuffer
+
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			for i := 0; i < 10; i++ {
+				out.Write([]byte("plain text log\n"))
+			}
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			io.ReadAll(stdin)
+			return 0
+		},
+	}
+
+	opts := JqFlagOptions{RateLimit: RateLimit{Count: 3, Per: time.Hour}}
+	if exitCode := runner.Run([]string{}, ".", opts); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+
+	if got := strings.Count(stdout.String(), "plain text log"); got != 3 {
+		t.Errorf("expected 3 lines to pass the rate limit, got %d", got)
+	}
+	if !strings.Contains(stderr.String(), "7 lines dropped") {
+		t.Errorf("expected drop notice on stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunner_Run_RateLimitQuiet(t *testing.T) {
+	// The drops of a burst are reported when its window ends, while the stream is quiet
+	var stdout bytes.Buffer
+	var stderr lockedBuffer
+	var reported atomic.Bool
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			for i := 0; i < 5; i++ {
+				out.Write([]byte("plain text log\n"))
+			}
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && !reported.Load(); {
+				time.Sleep(10 * time.Millisecond)
+				reported.Store(strings.Contains(stderr.String(), "4 lines dropped"))
+			}
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			io.ReadAll(stdin)
+			return 0
+		},
+	}
+
+	opts := JqFlagOptions{RateLimit: RateLimit{Count: 1, Per: 50 * time.Millisecond}}
+	if exitCode := runner.Run([]string{}, ".", opts); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	if !reported.Load() {
+		t.Errorf("expected drop notice before the stream ended, got %q", stderr.String())
+	}
+	if got := strings.Count(stderr.String(), "dropped"); got != 1 {
+		t.Errorf("expected a single drop notice, got %q", stderr.String())
+	}
+}
+
+func TestRunner_Run_MultilineIdle(t *testing.T) {
+	// A pending record that never closes is emitted while following, once the stream goes quiet
+	saved := multilineIdle
+	multilineIdle = 20 * time.Millisecond
+	defer func() { multilineIdle = saved }()
+
+	var stdout lockedBuffer
+	var flushed atomic.Bool
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			out.Write([]byte("{\n  \"a\": 1,\n"))
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && !flushed.Load(); {
+				time.Sleep(10 * time.Millisecond)
+				flushed.Store(strings.Contains(stdout.String(), `"a": 1,`))
+			}
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			io.ReadAll(stdin)
+			return 0
+		},
+	}
+
+	if exitCode := runner.Run([]string{"-f"}, ".", JqFlagOptions{}); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	if !flushed.Load() {
+		t.Errorf("expected the held lines before the stream ended, got %q", stdout.String())
+	}
+	if got := strings.Count(stdout.String(), `"a": 1,`); got != 1 {
+		t.Errorf("expected the held lines once, got %q", stdout.String())
+	}
+}
+
+func TestRunner_Run_Highlight(t *testing.T) {
+	var stdout, stderr lockedBuffer
+
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			out.Write([]byte("plain timeout\n"))
+			out.Write([]byte("{\"msg\":\"json timeout\"}\n"))
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			// Mock jq echoes its input, so the JSON line comes back as jq output
+			io.Copy(out, stdin)
+			return 0
+		},
+	}
+
+	// stdout is not a terminal, so -C is needed to force highlighting
+	opts := JqFlagOptions{Color: true, Highlight: []string{"timeout"}}
+	if exitCode := runner.Run([]string{}, ".", opts); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	outStr := stdout.String()
+	if !strings.Contains(outStr, "plain "+mark("timeout")) {
+		t.Errorf("plain text line not highlighted: %q", outStr)
+	}
+	if !strings.Contains(outStr, `{"msg":"json `+mark("timeout")+`"}`) {
+		t.Errorf("jq output not highlighted: %q", outStr)
+	}
+
+	// Without a terminal or -C, output is left alone
+	stdout.Reset()
+	runner.Run([]string{}, ".", JqFlagOptions{Highlight: []string{"timeout"}})
+	time.Sleep(50 * time.Millisecond)
+	if strings.Contains(stdout.String(), highlightOn) {
+		t.Errorf("expected no highlighting when stdout is not a terminal: %q", stdout.String())
+	}
+}
+
+func TestRunner_Run_HighlightTerminal(t *testing.T) {
+	defer func(saved func(io.Writer) bool) { isTerminal = saved }(isTerminal)
+	isTerminal = func(io.Writer) bool { return true }
+
+	tests := []struct {
+		name      string
+		opts      JqFlagOptions
+		wantColor bool
+	}{
+		{name: "Keeps jq Colors", opts: JqFlagOptions{Highlight: []string{"timeout"}}, wantColor: true},
+		{name: "Monochrome", opts: JqFlagOptions{Monochrome: true, Highlight: []string{"timeout"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout lockedBuffer
+			runner := &Runner{
+				Stdout: &stdout,
+				Stderr: io.Discard,
+				ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+					out.Write([]byte("{\"msg\":\"json timeout\"}\n"))
+					return nil
+				},
+				ExecJq: NewDefaultRunner().ExecJq,
+			}
+			if exitCode := runner.Run([]string{}, ".", tt.opts); exitCode != 0 {
+				t.Errorf("expected 0, got %d", exitCode)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			out := stdout.String()
+			if got := strings.Contains(out, "\x1b[") && strings.Contains(out, "\x1b[0m"); got != tt.wantColor {
+				t.Errorf("jq colors = %v, want %v: %q", got, tt.wantColor, out)
+			}
+			if got := strings.Contains(out, mark("timeout")); got != tt.wantColor {
+				t.Errorf("highlighted = %v, want %v: %q", got, tt.wantColor, out)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_Redact(t *testing.T) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	var jqInput string
+
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			out.Write([]byte("login bob@example.com\n"))
+			out.Write([]byte("{\"password\":\"hunter2\",\"msg\":\"ok\"}\n"))
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			data, _ := io.ReadAll(stdin)
+			jqInput = string(data)
+			return 0
+		},
+	}
+
+	opts := JqFlagOptions{Redact: []string{"password", "preset:email"}}
+	if exitCode := runner.Run([]string{}, ".", opts); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if strings.Contains(jqInput, "hunter2") || !strings.Contains(jqInput, `"password":"[REDACTED]"`) {
+		t.Errorf("expected password to be redacted before jq, got %q", jqInput)
+	}
+	if !strings.Contains(stdout.String(), "login [REDACTED]") {
+		t.Errorf("expected email to be redacted in plain text, got %q", stdout.String())
+	}
+}
+
+func TestRunner_Run_RedactParseJSON(t *testing.T) {
+	// Secrets inside embedded JSON stay masked once --parse-json decodes it
+	var stdout bytes.Buffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			out.Write([]byte(`{"payload":"{\"password\":\"hunter2\"}"}` + "\n"))
+			out.Write([]byte(`{"log":"{\"token\":\"abc\"}\n","stream":"stdout"}` + "\n"))
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	opts := JqFlagOptions{Raw: true, Redact: []string{"password", "token"}, ParseJSON: true}
+	if exitCode := runner.Run([]string{}, `.payload.password // .log.token`, opts); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if want := "[REDACTED]\n[REDACTED]\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestRunner_Run_MaxLine(t *testing.T) {
+	huge := `{"payload":"` + strings.Repeat("x", 3<<20) + `"}`
+
+	tests := []struct {
+		policy     string
+		wantJq     string
+		wantText   string
+		wantStderr string
+	}{
+		{
+			policy:   MaxLineTruncate,
+			wantJq:   `{"n":1}` + "\n" + `{"n":2}` + "\n",
+			wantText: `{"payload":"xxxx` + " [jqlogs: truncated " + strconv.Itoa(len(huge)-16) + " bytes]\n",
+		},
+		{
+			policy:     MaxLineSkip,
+			wantJq:     `{"n":1}` + "\n" + `{"n":2}` + "\n",
+			wantStderr: "[jqlogs] skipped a line of " + strconv.Itoa(len(huge)) + " bytes (over --max-line-size 16)\n",
+		},
+		{
+			policy: MaxLinePass,
+			wantJq: `{"n":1}` + "\n" + huge + "\n" + `{"n":2}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			var jqInput string
+			runner := &Runner{
+				Stdout: &stdout,
+				Stderr: &stderr,
+				ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+					io.WriteString(out, `{"n":1}`+"\n"+huge+"\n"+`{"n":2}`+"\n")
+					return nil
+				},
+				ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+					data, _ := io.ReadAll(stdin)
+					jqInput = string(data)
+					return 0
+				},
+			}
+
+			// Streaming goes on after the oversized line
+			opts := JqFlagOptions{MaxLineSize: 16, MaxLinePolicy: tt.policy}
+			if exitCode := runner.Run(nil, ".", opts); exitCode != 0 {
+				t.Errorf("expected 0, got %d", exitCode)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			if jqInput != tt.wantJq {
+				t.Errorf("jq input = %.80q, want %.80q", jqInput, tt.wantJq)
+			}
+			if stdout.String() != tt.wantText {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantText)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_MaxLinePartial(t *testing.T) {
+	// A line assembled from CRI partial chunks follows --max-line-policy too
+	var logs strings.Builder
+	for i := 0; i < 1000; i++ {
+		logs.WriteString("2026-01-15T10:00:00Z stdout P xxxxxxxxxx\n")
+	}
+	logs.WriteString("2026-01-15T10:00:00Z stdout F end\n")
+	logs.WriteString("2026-01-15T10:00:01Z stdout F {\"n\":1}\n")
+
+	tests := []struct {
+		policy     string
+		wantText   string
+		wantStderr string
+	}{
+		{
+			policy:   MaxLineTruncate,
+			wantText: strings.Repeat("x", 64) + " [jqlogs: truncated 9939 bytes]\n",
+		},
+		{
+			policy:     MaxLineSkip,
+			wantStderr: "[jqlogs] skipped a line of 10003 bytes (over --max-line-size 64)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			var jqInput string
+			runner := &Runner{
+				Stdout: &stdout,
+				Stderr: &stderr,
+				ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+					io.WriteString(out, logs.String())
+					return nil
+				},
+				ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+					data, _ := io.ReadAll(stdin)
+					jqInput = string(data)
+					return 0
+				},
+			}
+
+			opts := JqFlagOptions{Unwrap: true, MaxLineSize: 64, MaxLinePolicy: tt.policy}
+			if exitCode := runner.Run(nil, ".", opts); exitCode != 0 {
+				t.Errorf("expected 0, got %d", exitCode)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			if !strings.Contains(jqInput, `"__jqlogs_record":{"n":1}`) {
+				t.Errorf("jq input = %q, want the record after the long line", jqInput)
+			}
+			if stdout.String() != tt.wantText {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantText)
+			}
+			if stderr.String() != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr.String(), tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_Multiline(t *testing.T) {
+	pretty := "{\n  \"level\": \"info\",\n  \"msg\": \"hi\"\n}\n"
+
+	tests := []struct {
+		name     string
+		opts     JqFlagOptions
+		wantJq   string
+		wantText string
+	}{
+		{
+			name:     "Assembled",
+			opts:     JqFlagOptions{},
+			wantJq:   `{"level":"info","msg":"hi"}` + "\n",
+			wantText: "starting\n",
+		},
+		{
+			name:     "Disabled",
+			opts:     JqFlagOptions{NoMultiline: true},
+			wantJq:   "{\n",
+			wantText: "starting\n  \"level\": \"info\",\n  \"msg\": \"hi\"\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout lockedBuffer
+			var jqInput string
+			runner := &Runner{
+				Stdout: &stdout,
+				Stderr: io.Discard,
+				ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+					io.WriteString(out, "starting\n"+pretty)
+					return nil
+				},
+				ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+					data, _ := io.ReadAll(stdin)
+					jqInput = string(data)
+					return 0
+				},
+			}
+			if exitCode := runner.Run(nil, ".", tt.opts); exitCode != 0 {
+				t.Errorf("expected 0, got %d", exitCode)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			if jqInput != tt.wantJq {
+				t.Errorf("jq input = %q, want %q", jqInput, tt.wantJq)
+			}
+			if stdout.String() != tt.wantText {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantText)
+			}
+		})
+	}
+}
+
+func TestRunner_Run_Concatenated(t *testing.T) {
+	var jqInput string
+	runner := &Runner{
+		Stdout: io.Discard,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			io.WriteString(out, `{"n":1}{"n":2} done`+"\n")
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			data, _ := io.ReadAll(stdin)
+			jqInput = string(data)
+			return 0
+		},
+	}
+	if exitCode := runner.Run(nil, ".", JqFlagOptions{}); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if want := `{"n":1}` + "\n" + `{"n":2,"_trailing":"done"}` + "\n"; jqInput != want {
+		t.Errorf("jq input = %q, want %q", jqInput, want)
+	}
+}
+
+func TestRunner_Run_InvalidQuery(t *testing.T) {
+	var stderr bytes.Buffer
+	started := false
+	runner := &Runner{
+		Stdout: io.Discard,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			started = true
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			t.Error("jq should not run")
+			return 0
+		},
+	}
+
+	if exitCode := runner.Run([]string{"pod"}, ".msg | )", JqFlagOptions{}); exitCode != QueryErrorExitCode {
+		t.Errorf("exit code = %d, want %d", exitCode, QueryErrorExitCode)
+	}
+	if started {
+		t.Error("kubectl was started for an invalid query")
+	}
+	if want := "Error: invalid query: unexpected token \")\"\n    .msg | )\n           ^\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func TestRunner_Run_Strict(t *testing.T) {
+	logs := "plain text\n" + `{"msg":"OK"}` + "\n" + `{"msg":42}` + "\n[INFO] starting\n"
+	tests := []struct {
+		name       string
+		logs       string
+		strict     bool
+		wantCode   int
+		wantOut    []string
+		notOut     []string
+		wantStderr []string
+	}{
+		{
+			name:       "Errors Are Counted",
+			wantOut:    []string{"plain text", "ok", `{"msg":42}`, "[INFO] starting"},
+			wantStderr: []string{"[jqlogs] 1 query errors, the original lines were printed instead (see them with --strict)"},
+		},
+		{
+			name:     "Strict",
+			strict:   true,
+			wantCode: StrictExitCode,
+			wantOut:  []string{"plain text", "ok", "[INFO] starting"},
+			notOut:   []string{`{"msg":42}`},
+			wantStderr: []string{
+				"[jqlogs] line 3: query error: ascii_downcase cannot be applied to: number (42)",
+				"[jqlogs] 1 query errors, 1 lines starting with { or [ were not JSON",
+			},
+		},
+		{
+			name:     "Strict Reports Input Lines",
+			logs:     "{\n  \"msg\": \"OK\"\n}\n" + `{"msg":true}{"msg":"OK"}` + "\n" + `{"msg":42}` + "\n",
+			strict:   true,
+			wantCode: StrictExitCode,
+			wantStderr: []string{
+				"[jqlogs] line 4: query error: ascii_downcase cannot be applied to: boolean (true)",
+				"[jqlogs] line 5: query error: ascii_downcase cannot be applied to: number (42)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Text lines and jq's output are written from different goroutines
+			var stdout, stderr lockedBuffer
+			input := logs
+			if tt.logs != "" {
+				input = tt.logs
+			}
+			runner := &Runner{
+				Stdout: &stdout,
+				Stderr: &stderr,
+				ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+					io.WriteString(out, input)
+					return nil
+				},
+				ExecJq: NewDefaultRunner().ExecJq,
+			}
+			opts := JqFlagOptions{Raw: true, Strict: tt.strict}
+			if exitCode := runner.Run(nil, ".msg | ascii_downcase", opts); exitCode != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", exitCode, tt.wantCode)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			for _, want := range tt.wantOut {
+				if !strings.Contains(stdout.String(), want+"\n") {
+					t.Errorf("stdout = %q, want it to contain %q", stdout.String(), want)
+				}
+			}
+			for _, unwanted := range tt.notOut {
+				if strings.Contains(stdout.String(), unwanted) {
+					t.Errorf("stdout = %q, want it without %q", stdout.String(), unwanted)
+				}
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want+"\n") {
+					t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunner_Run_Unwrap(t *testing.T) {
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	var jqInput string
+
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			out.Write([]byte("2026-01-15T10:00:00Z stdout F plain text\n"))
+			out.Write([]byte("2026-01-15T10:00:00Z stdout P {\"msg\":\n"))
+			out.Write([]byte("2026-01-15T10:00:00Z stdout F \"hi\"}\n"))
+			return nil
+		},
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			data, _ := io.ReadAll(stdin)
+			jqInput = string(data)
+			return 0
+		},
+	}
+
+	if exitCode := runner.Run([]string{}, ".", JqFlagOptions{Unwrap: true}); exitCode != 0 {
+		t.Errorf("expected 0, got %d", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if stdout.String() != "plain text\n" {
+		t.Errorf("expected unwrapped plain text, got %q", stdout.String())
+	}
+	want := `{"__jqlogs_envelope":{"format":"cri","stream":"stdout","time":"2026-01-15T10:00:00Z"},"__jqlogs_record":{"msg":"hi"}}` + "\n"
+	if jqInput != want {
+		t.Errorf("jq input = %q, want %q", jqInput, want)
+	}
+}
+
+func TestRunner_RunReplay(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	kubectlRuns := 0
+
+	runner := &Runner{
+		Stdin:  strings.NewReader(".a\n\n:info\n:bogus\n@nope\n.a |\n:q\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			kubectlRuns++
+			out.Write([]byte("{\"a\":1}\nplain text\n{\"a\":2}\n"))
+			return nil
+		},
+		// Mock jq: report the query and how many JSON lines it got
+		ExecJq: func(args []string, stdin io.Reader, out io.Writer, errOut io.Writer) int {
+			data, _ := io.ReadAll(stdin)
+			query := args[len(args)-1]
+			fmt.Fprintf(out, "query has .a: %v, %d JSON lines\n", strings.Contains(query, "(.a)"), strings.Count(string(data), "\n"))
+			return 0
+		},
+	}
+
+	if exitCode := runner.RunReplay([]string{"pod"}, "", JqFlagOptions{}); exitCode != 0 {
+		t.Fatalf("RunReplay() = %d, want 0", exitCode)
+	}
+
+	// The query is run twice (typed, then re-run with an empty line) over the same buffer
+	want := "plain text\nquery has .a: true, 2 JSON lines\nplain text\nquery has .a: true, 2 JSON lines\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	if kubectlRuns != 1 {
+		t.Errorf("kubectl ran %d times, want 1", kubectlRuns)
+	}
+	for _, want := range []string{
+		"[jqlogs] 3 lines replayed",
+		"3 lines buffered of 3 received, stream ended, last query: .a",
+		"unknown command :bogus",
+		"unknown macro @nope",
+		"Error: invalid query: unexpected EOF\n    .a |\n        ^\n",
+		"jqlogs[3]> ",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr = %q, want it to contain %q", stderr.String(), want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// DefaultSchemaLines is the number of recent lines read by --schema when --tail is not given.
+const DefaultSchemaLines = 1000
+
+const (
+	schemaMaxExamples  = 3  // distinct example values shown per field
+	schemaExampleWidth = 40 // example values are cut to this many runes
+	schemaMaxColumns   = 6  // fields in the suggested --kv query
+)
+
+// schemaMessageFields are the fields checked for a record's message, for suggested queries.
+var schemaMessageFields = []string{"msg", "message", "log", "text", "error", "err"}
+
+// Schema is the union of the field paths found in a sample of records.
+type Schema struct {
+	Records int
+	fields  map[string]*SchemaField
+}
+
+// SchemaField describes a field path of a Schema.
+type SchemaField struct {
+	Path     string
+	Types    []string // JSON types seen, in alphabetical order
+	Count    int      // number of records that have the field
+	Examples []string // distinct scalar values, as JSON
+}
+
+// NewSchema creates an empty schema.
+func NewSchema() *Schema {
+	return &Schema{fields: make(map[string]*SchemaField)}
+}
+
+// Add adds the field paths of a decoded JSON record.
+func (s *Schema) Add(record any) {
+	s.Records++
+	seen := make(map[string]bool)
+	walkFields(record, func(path string, value any) {
+		f, ok := s.fields[path]
+		if !ok {
+			f = &SchemaField{Path: path}
+			s.fields[path] = f
+		}
+		if !seen[path] {
+			seen[path] = true
+			f.Count++
+		}
+		f.addType(jsonType(value))
+		f.addExample(value)
+	})
+}
+
+// Fields returns the fields in path order.
+func (s *Schema) Fields() []*SchemaField {
+	fields := make([]*SchemaField, 0, len(s.fields))
+	for _, f := range s.fields {
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+	return fields
+}
+
+// Presence returns the percentage of records that have the field.
+func (s *Schema) Presence(f *SchemaField) float64 {
+	if s.Records == 0 {
+		return 0
+	}
+	return 100 * float64(f.Count) / float64(s.Records)
+}
+
+func (f *SchemaField) addType(t string) {
+	i := sort.SearchStrings(f.Types, t)
+	if i < len(f.Types) && f.Types[i] == t {
+		return
+	}
+	f.Types = append(f.Types[:i], append([]string{t}, f.Types[i:]...)...)
+}
+
+func (f *SchemaField) addExample(v any) {
+	if len(f.Examples) == schemaMaxExamples {
+		return
+	}
+	switch v.(type) {
+	case nil, map[string]any, []any:
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	example := string(b)
+	if r := []rune(example); len(r) > schemaExampleWidth {
+		example = string(r[:schemaExampleWidth-1]) + "…"
+	}
+	for _, e := range f.Examples {
+		if e == example {
+			return
+		}
+	}
+	f.Examples = append(f.Examples, example)
+}
+
+// scalar reports whether the field only holds strings, numbers or booleans, as Smart Query
+// columns do best.
+func (f *SchemaField) scalar() bool {
+	for _, t := range f.Types {
+		if t == "object" || t == "array" || t == "null" {
+			return false
+		}
+	}
+	return !strings.Contains(f.Path, "[]")
+}
+
+// jsonType returns the JSON type name of a decoded value, as jq's type does.
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return "number" // float64, int, json.Number, *big.Int
+	}
+}
+
+// SuggestedQueries returns Smart Queries for the most common fields: the time, level and
+// message fields (or the most common ones), and a --kv query with some more.
+// Only scalar fields present in at least half of the records are considered.
+func (s *Schema) SuggestedQueries(opts JqFlagOptions) []string {
+	var common []*SchemaField
+	for _, f := range s.Fields() {
+		if f.scalar() && s.Presence(f) >= 50 {
+			common = append(common, f)
+		}
+	}
+	if len(common) == 0 {
+		return nil
+	}
+
+	// Key fields first, the others by presence
+	var key []string
+	for _, names := range [][]string{opts.timeFields(), opts.levelFields(), schemaMessageFields} {
+		for _, name := range names {
+			if f := s.fields[namePath(name)]; f != nil && f.scalar() && s.Presence(f) >= 50 {
+				key = append(key, f.Path)
+				break
+			}
+		}
+	}
+	sort.SliceStable(common, func(i, j int) bool { return common[i].Count > common[j].Count })
+	columns := append([]string(nil), key...)
+	for _, f := range common {
+		if len(columns) == schemaMaxColumns {
+			break
+		}
+		if !slices.Contains(columns, f.Path) {
+			columns = append(columns, f.Path)
+		}
+	}
+	if len(key) == 0 {
+		key = columns[:min(3, len(columns))]
+	}
+
+	return []string{
+		"-- " + shellQuote(smartPaths(key)),
+		"--kv -- " + shellQuote(smartPaths(columns)),
+	}
+}
+
+// namePath turns a dotted field name (log.level) into its jq path.
+func namePath(name string) string {
+	var path strings.Builder
+	for _, key := range strings.Split(name, ".") {
+		path.WriteString(fieldPathKey(key))
+	}
+	return path.String()
+}
+
+var quotedAtFieldRegexp = regexp.MustCompile(`^\."(@[A-Za-z0-9_]+)"$`)
+
+// smartPaths joins paths into a Smart Query, writing ."@field" as Smart Query's .@field.
+func smartPaths(paths []string) string {
+	parts := make([]string, len(paths))
+	for i, p := range paths {
+		parts[i] = quotedAtFieldRegexp.ReplaceAllString(p, ".$1")
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote quotes s for a POSIX shell, when needed.
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`|&;<>(){}[]*?!#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Write prints the schema as a table, followed by the suggested queries for kubectlArgs.
+func (s *Schema) Write(w io.Writer, kubectlArgs []string, opts JqFlagOptions) {
+	fmt.Fprintf(w, "# %d JSON records sampled\n", s.Records)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tTYPE\tPRESENT\tEXAMPLES")
+	for _, f := range s.Fields() {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%s\n", f.Path, strings.Join(f.Types, "|"), s.Presence(f), strings.Join(f.Examples, ", "))
+	}
+	tw.Flush()
+
+	queries := s.SuggestedQueries(opts)
+	if len(queries) == 0 {
+		return
+	}
+	command := "kubectl jqlogs"
+	for _, arg := range append(slices.Clone(kubectlArgs), opts.preprocessFlags()...) {
+		command += " " + shellQuote(arg)
+	}
+	fmt.Fprintln(w, "\n# Suggested Smart Queries")
+	for _, q := range queries {
+		fmt.Fprintf(w, "%s %s\n", command, q)
+	}
+}
+
+// preprocessFlags returns the flags that shape the records before the query sees them, so that
+// the suggested queries are run against the same field paths.
+func (o JqFlagOptions) preprocessFlags() []string {
+	var flags []string
+	for _, f := range []struct {
+		flag string
+		on   bool
+	}{{"--unwrap", o.Unwrap}, {"--parse-json", o.ParseJSON}, {"--flatten", o.Flatten}} {
+		if f.on {
+			flags = append(flags, f.flag)
+		}
+	}
+	return flags
+}
+
+// RunSchema reads a sample of the logs (--schema) and prints the fields of their JSON records:
+// types, presence and examples, with suggested Smart Queries. It reads the last
+// DefaultSchemaLines lines, or the ones selected by --tail, without following. Returns exit code.
+func (r *Runner) RunSchema(kubectlArgs []string, opts JqFlagOptions) int {
+	n := DefaultSchemaLines
+	for _, arg := range kubectlArgs {
+		if arg == "--tail" || strings.HasPrefix(arg, "--tail=") {
+			n = 0
+		}
+	}
+
+	schema := NewSchema()
+	if err := r.SampleRecords(kubectlArgs, opts, n, schema.Add); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if schema.Records == 0 {
+		fmt.Fprintf(r.Stderr, "[jqlogs] no JSON records found\n")
+		return 0
+	}
+	schema.Write(r.Stdout, kubectlArgs, opts)
+	return 0
+}
@@ -0,0 +1,164 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeRecords decodes JSON lines like gojq's fromjson does
+func decodeRecords(t *testing.T, lines ...string) []any {
+	t.Helper()
+	var records []any
+	for _, line := range lines {
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, v)
+	}
+	return records
+}
+
+func TestSchema(t *testing.T) {
+	schema := NewSchema()
+	for _, record := range decodeRecords(t,
+		`{"level":"info","msg":"a","ts":1760600000,"user":{"id":1},"tags":["x","y"]}`,
+		`{"level":"error","msg":"a","ts":"2026-01-01T00:00:00Z","tags":[]}`,
+		`{"level":"info","msg":"`+strings.Repeat("long ", 10)+`","ts":null}`,
+		`{"level":"debug","msg":"b","ts":1760600001,"items":[{"id":1},{"id":2,"ok":true}]}`,
+	) {
+		schema.Add(record)
+	}
+
+	type row struct {
+		types    string
+		presence float64
+		examples []string
+	}
+	got := make(map[string]row)
+	var paths []string
+	for _, f := range schema.Fields() {
+		paths = append(paths, f.Path)
+		got[f.Path] = row{strings.Join(f.Types, "|"), schema.Presence(f), f.Examples}
+	}
+
+	if want := []string{".items", ".items[]", ".items[].id", ".items[].ok", ".level", ".msg", ".tags", ".tags[]", ".ts", ".user", ".user.id"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths = %q, want %q", paths, want)
+	}
+	tests := []struct {
+		path string
+		want row
+	}{
+		// At most 3 distinct examples
+		{path: ".level", want: row{"string", 100, []string{`"info"`, `"error"`, `"debug"`}}},
+		// Long values are cut
+		{path: ".msg", want: row{"string", 100, []string{`"a"`, `"long long long long long long long lon…`, `"b"`}}},
+		{path: ".ts", want: row{"null|number|string", 100, []string{"1760600000", `"2026-01-01T00:00:00Z"`, "1760600001"}}},
+		{path: ".tags", want: row{"array", 50, nil}},
+		{path: ".tags[]", want: row{"string", 25, []string{`"x"`, `"y"`}}},
+		{path: ".items[].id", want: row{"number", 25, []string{"1", "2"}}},
+		{path: ".user.id", want: row{"number", 25, []string{"1"}}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(got[tt.path], tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.path, got[tt.path], tt.want)
+		}
+	}
+}
+
+func TestSchema_SuggestedQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []string
+	}{
+		{
+			name: "Key Fields First",
+			lines: []string{
+				`{"@timestamp":"t","severity":"INFO","message":"hi","pod":"p","code":1,"rare":1}`,
+				`{"@timestamp":"t","severity":"INFO","message":"hi","pod":"p","code":2}`,
+				`{"@timestamp":"t","severity":"INFO","message":"hi","pod":"p"}`,
+			},
+			want: []string{
+				"-- '.@timestamp .severity .message'",
+				"--kv -- '.@timestamp .severity .message .pod .code'",
+			},
+		},
+		{
+			name:  "Most Common Without Key Fields",
+			lines: []string{`{"a":1,"b":{"c":"x"},"d":[1],"e":null}`},
+			want:  []string{"-- '.a .b.c'", "--kv -- '.a .b.c'"},
+		},
+		{
+			name:  "No Scalar Fields",
+			lines: []string{`{"a":[1]}`},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := NewSchema()
+			for _, record := range decodeRecords(t, tt.lines...) {
+				schema.Add(record)
+			}
+			if got := schema.SuggestedQueries(JqFlagOptions{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SuggestedQueries() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunner_RunSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		kubectlArgs []string
+		opts        JqFlagOptions
+		wantArgs    []string
+		wantCommand string
+	}{
+		{name: "Default Sample", kubectlArgs: []string{"-f", "pod"}, wantArgs: []string{"pod", "--tail=1000"}, wantCommand: "kubectl jqlogs -f pod --"},
+		{name: "With Tail", kubectlArgs: []string{"pod", "--tail", "50"}, wantArgs: []string{"pod", "--tail", "50"}, wantCommand: "kubectl jqlogs pod --tail 50 --"},
+		{
+			name:        "Preprocessing Flags",
+			kubectlArgs: []string{"pod"},
+			opts:        JqFlagOptions{Unwrap: true, ParseJSON: true, Flatten: true, Raw: true},
+			wantArgs:    []string{"pod", "--tail=1000"},
+			wantCommand: "kubectl jqlogs pod --unwrap --parse-json --flatten --",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgs []string
+			var stdout bytes.Buffer
+			runner := &Runner{
+				Stdout: &stdout,
+				Stderr: io.Discard,
+				ExecKubectl: func(args []string, stdout io.Writer, stderr io.Writer) error {
+					gotArgs = args
+					io.WriteString(stdout, "starting\n"+`{"level":"info","msg":"hi"}`+"\n")
+					return nil
+				},
+			}
+			if code := runner.RunSchema(tt.kubectlArgs, tt.opts); code != 0 {
+				t.Fatalf("RunSchema() = %d, want 0", code)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("kubectl args = %q, want %q", gotArgs, tt.wantArgs)
+			}
+			out := stdout.String()
+			for _, want := range []string{"# 1 JSON records sampled", `.level  string  100.0%   "info"`, tt.wantCommand + " '.level .msg'"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("output = %q, want it to contain %q", out, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// RunSlurp collects the JSON records of the stream into one array (--slurp) and runs the
+// query once over it when the logs end, like jq -s. Plain text lines are printed as they
+// come, or added to the array as strings with --slurp-text. Returns exit code.
+func (r *Runner) RunSlurp(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	filter, err := newStreamFilter(opts)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// jq gets a single input and reports a failing query itself
+	opts.Strict = false
+	return r.process(jqQuery, opts, func(emit func(line []byte, number int, isJSON bool)) {
+		records := newSlurper(opts.SlurpText)
+		r.stream(kubectlArgs, filter, func(line []byte, number int, isJSON bool) {
+			if !records.add(line, isJSON) {
+				emit(line, number, false)
+			}
+		})
+		emit(records.array(), 0, true)
+	})
+}
+
+// slurper accumulates records into a JSON array.
+type slurper struct {
+	text bool // keep text lines, as strings
+	buf  bytes.Buffer
+	n    int
+}
+
+func newSlurper(text bool) *slurper {
+	s := &slurper{text: text}
+	s.buf.WriteByte('[')
+	return s
+}
+
+// add appends a line to the array and reports whether it was taken: JSON records always,
+// other lines when text lines are kept.
+func (s *slurper) add(line []byte, isJSON bool) bool {
+	var value []byte
+	switch {
+	case isJSON && json.Valid(line):
+		value = line
+	case s.text:
+		value, _ = json.Marshal(string(line))
+	default:
+		return false
+	}
+	if s.n > 0 {
+		s.buf.WriteByte(',')
+	}
+	s.buf.Write(value)
+	s.n++
+	return true
+}
+
+// array returns the array of the records added so far.
+func (s *slurper) array() []byte {
+	return append(bytes.Clone(s.buf.Bytes()), ']')
+}
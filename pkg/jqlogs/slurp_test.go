@@ -0,0 +1,80 @@
+package jqlogs
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSlurper(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      bool
+		wantArray string
+		wantTaken []bool
+	}{
+		{
+			name:      "Records Only",
+			wantArray: `[{"u":"a"},[1]]`,
+			wantTaken: []bool{true, false, false, true},
+		},
+		{
+			name:      "With Text",
+			text:      true,
+			wantArray: `[{"u":"a"},"plain \"quoted\"","[INFO] x",[1]]`,
+			wantTaken: []bool{true, true, true, true},
+		},
+	}
+
+	lines := []struct {
+		line   string
+		isJSON bool
+	}{
+		{`{"u":"a"}`, true},
+		{`plain "quoted"`, false},
+		{"[INFO] x", true}, // starts like JSON, but isn't
+		{"[1]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSlurper(tt.text)
+			for i, l := range lines {
+				if got := s.add([]byte(l.line), l.isJSON); got != tt.wantTaken[i] {
+					t.Errorf("add(%q) = %v, want %v", l.line, got, tt.wantTaken[i])
+				}
+			}
+			if got := string(s.array()); got != tt.wantArray {
+				t.Errorf("array() = %s, want %s", got, tt.wantArray)
+			}
+		})
+	}
+
+	if got := string(newSlurper(false).array()); got != "[]" {
+		t.Errorf("empty array() = %s, want []", got)
+	}
+}
+
+func TestRunner_RunSlurp(t *testing.T) {
+	var stdout lockedBuffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			io.WriteString(out, "{\"user\":\"a\"}\n{\"user\":\"b\"}\nplain text\n{\n  \"user\": \"a\"\n}\n")
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	opts := JqFlagOptions{Compact: true, Slurp: true}
+	if exitCode := runner.RunSlurp(nil, "group_by(.user) | map({user: .[0].user, n: length})", opts); exitCode != 0 {
+		t.Errorf("exit code = %d, want 0", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Text lines are printed as they come, the query's output at the end
+	want := "plain text\n" + `[{"n":2,"user":"a"},{"n":1,"user":"b"}]` + "\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
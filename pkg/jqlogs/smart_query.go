@@ -1,17 +1,286 @@
 package jqlogs
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/itchyny/gojq"
 )
 
+// smartFormatters are the formatters usable in Smart Query columns as .field|name.
+// Each is a jq expression applied to non-null values.
+var smartFormatters = map[string]string{
+	// epoch seconds, millis, micros or nanos (guessed by magnitude) -> RFC3339; strings are kept
+	"time": `if type == "number" then (if . > 1e17 then . / 1e9 elif . > 1e14 then . / 1e6 elif . > 1e11 then . / 1e3 else . end | floor | todate) else . end`,
+	// duration in milliseconds -> 250ms, 1.5s, 2m3.5s
+	"ms":    `if type == "number" then (if . < 1000 then "\(.)ms" elif . < 60000 then "\(. / 1000)s" else "\(. / 60000 | floor)m\((. % 60000) / 1000)s" end) else . end`,
+	"upper": `ascii_upcase`,
+	"lower": `ascii_downcase`,
+	"json":  `tojson`,
+}
+
+var (
+	// smartLabelRegexp matches a column label prefix: lvl=.level
+	smartLabelRegexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*)=(\..*)$`)
+	// smartWidthRegexp matches a column width suffix: :5, :<5 (left aligned), :>5 (right aligned)
+	smartWidthRegexp = regexp.MustCompile(`:([<>]?)(\d+)$`)
+)
+
+// smartKeyValueFormat renders a value in key/value mode the way logfmt does: strings are
+// printed bare unless they are empty or contain spaces, quotes or "=", everything else as compact JSON.
+const smartKeyValueFormat = `if type == "string" then (if . == "" or test("[\\s\"=]") then tojson else . end) else tojson end`
+
+// smartColumn is one space-separated part of a Smart Query:
+//
+//	[label=]path[|formatter...][?:default][:[<>]width]
+type smartColumn struct {
+	label      string
+	path       string
+	formatters []string
+	def        *string
+	width      int
+	alignRight bool
+	keyValue   bool
+}
+
+// extended reports whether the column uses more than a plain path.
+func (c smartColumn) extended() bool {
+	return c.label != "" || len(c.formatters) > 0 || c.def != nil || c.width > 0
+}
+
+// expr returns the jq expression producing the column's value.
+func (c smartColumn) expr() string {
+	expr := c.path
+	if len(c.formatters) > 0 || c.def != nil || c.width > 0 {
+		expr = "(" + expr + ")"
+	}
+	for _, name := range c.formatters {
+		expr = fmt.Sprintf("(%s | if . == null then . else %s end)", expr, smartFormatters[name])
+	}
+	if c.def != nil {
+		lit, _ := json.Marshal(*c.def)
+		// Like jq's // (no output or an error takes the default too), but keeping false
+		expr = fmt.Sprintf("([(%s)?] | if . == [] then [null] else . end | .[] | if . == null then %s else . end)", expr, lit)
+	}
+	if c.keyValue {
+		expr = fmt.Sprintf("(%s | %s)", expr, smartKeyValueFormat)
+	}
+	if c.width > 0 {
+		pad := fmt.Sprintf(`(" " * (%d - length))`, c.width)
+		if c.alignRight {
+			expr = fmt.Sprintf("(%s | tostring | %s + .)", expr, pad)
+		} else {
+			expr = fmt.Sprintf("(%s | tostring | . + %s)", expr, pad)
+		}
+	}
+	return expr
+}
+
+// parseSmartColumn parses one part of a Smart Query. It returns false when the part
+// is not Smart Query syntax, in which case the whole query is treated as plain jq.
+func parseSmartColumn(part string) (smartColumn, bool) {
+	var c smartColumn
+	if m := smartLabelRegexp.FindStringSubmatch(part); m != nil {
+		c.label, part = m[1], m[2]
+	}
+
+	rest := part
+	if idx := indexTopLevel(part, "?:"); idx >= 0 {
+		// The path keeps its "?" so a failing access yields the default too
+		rest = part[:idx+1]
+		def := part[idx+2:]
+		if m := smartWidthRegexp.FindStringSubmatchIndex(def); m != nil {
+			if err := c.setWidth(def[m[2]:m[3]], def[m[4]:m[5]]); err != nil {
+				return c, false
+			}
+			def = def[:m[0]]
+		}
+		c.def = &def
+	} else if m := smartWidthRegexp.FindStringSubmatchIndex(rest); m != nil {
+		if err := c.setWidth(rest[m[2]:m[3]], rest[m[4]:m[5]]); err != nil {
+			return c, false
+		}
+		rest = rest[:m[0]]
+	}
+
+	segments := splitTopLevel(rest, '|')
+	c.path = segments[0]
+	if len(segments) > 1 && c.def != nil {
+		// The "?" of "?:" follows the last formatter: .ts|time?:-
+		segments[len(segments)-1] = strings.TrimSuffix(segments[len(segments)-1], "?")
+	}
+	for _, name := range segments[1:] {
+		if _, ok := smartFormatters[name]; !ok {
+			return c, false
+		}
+		c.formatters = append(c.formatters, name)
+	}
+
+	if !isSimplePath(c.path) {
+		return c, false
+	}
+	return c, true
+}
+
+func (c *smartColumn) setWidth(align, width string) error {
+	n, err := strconv.Atoi(width)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid width %q", width)
+	}
+	c.width, c.alignRight = n, align == ">"
+	return nil
+}
+
+// isSimplePath reports whether p is a pure path expression: field access, quoted keys,
+// constant array indexes and slices, each optionally followed by "?".
+// Examples: .a.b, ."@x", .items[0].name, .labels["app.kubernetes.io/name"], .xs[-1:]?
+func isSimplePath(p string) bool {
+	if !strings.HasPrefix(p, ".") {
+		return false
+	}
+	q, err := gojq.Parse(p)
+	if err != nil {
+		return false
+	}
+	if q.Term == nil || q.Left != nil || q.Right != nil || q.Op != 0 ||
+		q.Meta != nil || len(q.Imports) > 0 || len(q.FuncDefs) > 0 || len(q.Patterns) > 0 {
+		return false
+	}
+	t := q.Term
+	switch t.Type {
+	case gojq.TermTypeIdentity:
+	case gojq.TermTypeIndex:
+		if !isConstIndex(t.Index) {
+			return false
+		}
+	default:
+		return false
+	}
+	for _, suffix := range t.SuffixList {
+		// Iteration (.items[]) would turn one record into many columns
+		if suffix.Iter || (suffix.Index != nil && !isConstIndex(suffix.Index)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isConstIndex reports whether an index only uses constant keys, numbers and slice bounds.
+func isConstIndex(idx *gojq.Index) bool {
+	if idx.Str != nil && len(idx.Str.Queries) > 0 {
+		return false
+	}
+	return isConstQuery(idx.Start) && isConstQuery(idx.End)
+}
+
+func isConstQuery(q *gojq.Query) bool {
+	if q == nil {
+		return true
+	}
+	if q.Term == nil || q.Left != nil || q.Right != nil || len(q.Term.SuffixList) > 0 {
+		return false
+	}
+	switch q.Term.Type {
+	case gojq.TermTypeNumber, gojq.TermTypeNull:
+		return true
+	case gojq.TermTypeString:
+		return len(q.Term.Str.Queries) == 0
+	case gojq.TermTypeUnary:
+		return isConstQuery(&gojq.Query{Term: q.Term.Unary.Term})
+	}
+	return false
+}
+
+// indexTopLevel returns the index of sub in s outside of brackets and string literals, or -1.
+func indexTopLevel(s, sub string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			if end := closingQuote(s, i); end >= 0 {
+				i = end
+				continue
+			}
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		}
+		if depth == 0 && strings.HasPrefix(s[i:], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s on sep outside of brackets and string literals.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	for {
+		idx := indexTopLevel(s, string(sep))
+		if idx < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:idx])
+		s = s[idx+1:]
+	}
+}
+
+// key returns the name printed before the column's value in key/value mode:
+// the label if set, else the path without its leading dot (.user.id -> user.id, ."@ts" -> @ts).
+func (c smartColumn) key() string {
+	if c.label != "" {
+		return c.label
+	}
+	key := strings.TrimPrefix(c.path, ".")
+	if unquoted, err := strconv.Unquote(key); err == nil && strings.HasPrefix(key, `"`) {
+		return unquoted
+	}
+	if key == "" {
+		return "."
+	}
+	return key
+}
+
+// fixAtField rewrites the .@field shorthand into valid jq: .@field -> ."@field"
+func fixAtField(part string) (string, bool) {
+	if !strings.HasPrefix(part, ".@") {
+		return part, false
+	}
+	name := part[1:]
+	// Keep Smart Query suffixes (|formatter, ?:default, :width) outside the quoted key
+	if idx := strings.IndexAny(name, "|?:"); idx > 0 {
+		return "." + strconv.Quote(name[:idx]) + name[idx:], true
+	}
+	return "." + strconv.Quote(name), true
+}
+
 // SmartQuery tries to detect if the query is a simple list of fields like ".level .app_name"
 // and transforms it into a string interpolation query like "\(.level) \(.app_name)".
 // It also provides syntactic sugar for @-prefixed fields (e.g. .@timestamp -> ."@timestamp").
 // It prioritizes simple column selection if the query looks like a list of simple fields.
+//
+// Each field may be decorated as [label=]path[|formatter...][?:default][:[<>]width], e.g.
+// "lvl=.level:5 .ts|time .user.id?:- .dur|ms:>8". Formatters are time, ms, upper, lower and json.
 func SmartQuery(q string) string {
+	return smartQuery(q, false)
+}
+
+// SmartQueryKeyValue is SmartQuery printing every column as key=value, logfmt style:
+// ".level .msg .user" -> level=info msg=hello user={"id":1}.
+// Keys default to the field path; a label (lvl=.level) overrides it.
+func SmartQueryKeyValue(q string) string {
+	return smartQuery(q, true)
+}
+
+func smartQuery(q string, keyValue bool) string {
+	if keyValue && strings.TrimSpace(q) == "." {
+		// Every top-level field of the record
+		return `if type == "object" then ([to_entries[] | "\(.key)=\(.value | ` + smartKeyValueFormat + `)"] | join(" ")) else . end`
+	}
 	parts := strings.Fields(q)
 	if len(parts) == 0 {
 		return q
@@ -20,47 +289,52 @@ func SmartQuery(q string) string {
 	// Pre-process: Fix .@ syntax
 	anyFixed := false
 	for i, part := range parts {
-		if strings.HasPrefix(part, ".@") {
+		prefix := ""
+		if m := smartLabelRegexp.FindStringSubmatch(part); m != nil {
+			prefix, part = m[1]+"=", m[2]
+		}
+		if fixed, ok := fixAtField(part); ok {
 			// Auto-fix: .@field -> ."@field"
-			parts[i] = "." + fmt.Sprintf("%q", part[1:])
+			parts[i] = prefix + fixed
 			anyFixed = true
 		}
 	}
 
-	// If single part, return it (whether fixed or not)
+	columns := make([]smartColumn, 0, len(parts))
+	for _, part := range parts {
+		c, ok := parseSmartColumn(part)
+		if !ok {
+			columns = nil
+			break
+		}
+		c.keyValue = keyValue
+		columns = append(columns, c)
+	}
+
+	// If single plain part, return it (whether fixed or not)
 	// This allows ".@timestamp" -> ".\"@timestamp\"" (valid JQ)
 	// And ".level" -> ".level" (valid JQ)
-	if len(parts) == 1 {
+	if len(parts) == 1 && (len(columns) == 0 || (!columns[0].extended() && !keyValue)) {
 		if anyFixed {
 			return parts[0]
 		}
 		return q
 	}
 
-	// Heuristic for Simple Mode (multiple parts)
-	isSimple := true
-	for _, part := range parts {
-		if !strings.HasPrefix(part, ".") {
-			isSimple = false
-			break
-		}
-		// Check for characters that imply complex JQ logic
-		// Note: " is allowed now because we might have introduced it in pre-process
-		if strings.ContainsAny(part, `|[](){},`) {
-			isSimple = false
-			break
-		}
-	}
-
-	if isSimple {
+	if len(columns) > 0 {
 		var builder strings.Builder
 		builder.WriteString(`"`)
-		for i, part := range parts {
+		for i, c := range columns {
 			if i > 0 {
 				builder.WriteString(" ")
 			}
+			if c.label != "" || keyValue {
+				// JSON string escapes are valid in jq string literals
+				key, _ := json.Marshal(c.key() + "=")
+				builder.Write(key[1 : len(key)-1])
+			}
 			builder.WriteString(`\(`)
-			builder.WriteString(part)
+			builder.WriteString(c.expr())
 			builder.WriteString(`)`)
 		}
 		builder.WriteString(`"`)
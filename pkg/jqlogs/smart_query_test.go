@@ -2,6 +2,8 @@ package jqlogs
 
 import (
 	"testing"
+
+	"github.com/itchyny/gojq"
 )
 
 func TestSmartQuery(t *testing.T) {
@@ -60,3 +62,138 @@ func TestSmartQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestSmartQuery_Extended(t *testing.T) {
+	input := map[string]any{
+		"level":  "info",
+		"ts":     float64(1760600000123),
+		"dur":    float64(1530),
+		"user":   map[string]any{"name": "bob"},
+		"@tag":   "x",
+		"items":  []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}},
+		"labels": map[string]any{"app.kubernetes.io/name": "web"},
+		"codes":  []any{float64(1), float64(2), float64(3)},
+		"ready":  false,
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "Default For Missing Field", query: ".level .user.id?:-", want: "info -"},
+		{name: "Default Not Used", query: ".user.name?:- .level", want: "bob info"},
+		{name: "Default Keeps False", query: ".ready?:n/a .level", want: "false info"},
+		{name: "Label", query: "lvl=.level .user.name", want: "lvl=info bob"},
+		{name: "Width Left Aligned", query: ".level:6 .user.name", want: "info   bob"},
+		{name: "Width Right Aligned", query: ".level:>6 .user.name", want: "  info bob"},
+		{name: "Width Narrower Than Value", query: ".level:2 .user.name", want: "info bob"},
+		{name: "Time Formatter", query: ".ts|time .level", want: "2025-10-16T07:33:20Z info"},
+		{name: "Duration Formatter", query: ".dur|ms .level", want: "1.53s info"},
+		{name: "Chained Formatters", query: ".level|json|upper", want: `"INFO"`},
+		{name: "Formatter Skips Null", query: ".nope|time?:n/a", want: "n/a"},
+		{name: "Single Labelled Field", query: "lvl=.level", want: "lvl=info"},
+		{name: "All Combined", query: "L=.level|upper?:-:>5 .@tag", want: "L= INFO x"},
+		{name: "Array Index", query: ".items[0].name .items[-1].name", want: "a b"},
+		{name: "Bracketed Key", query: `.labels["app.kubernetes.io/name"] .level`, want: "web info"},
+		{name: "Quoted Key", query: `."level" .labels."app.kubernetes.io/name"`, want: "info web"},
+		{name: "Slice", query: ".codes[1:] .codes[:1]", want: "[2,3] [1]"},
+		{name: "Optional Access", query: ".user.name? .items[0]?.name", want: "bob a"},
+		{name: "Optional Index With Default", query: ".user[0]?:- .level", want: "- info"},
+		{name: "Index With Formatter And Width", query: ".items[1].name|upper:3 .level", want: "B   info"},
+		{name: "Bracketed Key With Colon", query: `.labels["a:5"]?:none .level`, want: "none info"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformed := SmartQuery(tt.query)
+			query, err := gojq.Parse(transformed)
+			if err != nil {
+				t.Fatalf("SmartQuery(%q) = %q is not valid jq: %v", tt.query, transformed, err)
+			}
+			v, ok := query.Run(input).Next()
+			if !ok {
+				t.Fatalf("SmartQuery(%q) = %q produced no output", tt.query, transformed)
+			}
+			if err, isErr := v.(error); isErr {
+				t.Fatalf("SmartQuery(%q) = %q failed: %v", tt.query, transformed, err)
+			}
+			if v != tt.want {
+				t.Errorf("SmartQuery(%q) evaluates to %q, want %q", tt.query, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestSmartQuery_ExtendedFallback(t *testing.T) {
+	// Not Smart Query syntax: left to jq as is
+	for _, q := range []string{
+		".a|length .b",
+		".a:x .b",
+		".items[] | .name",
+		`.a?:"x" | .b`,
+		".items[] .level",
+		".items[.n] .level",
+		`.labels["\(.k)"] .level`,
+		".a[1:.n] .b",
+		"(.a) .b",
+		".a.b[0] | .c",
+	} {
+		if got := SmartQuery(q); got != q {
+			t.Errorf("SmartQuery(%q) = %q, want unchanged", q, got)
+		}
+	}
+}
+
+func TestSmartQueryKeyValue(t *testing.T) {
+	input := map[string]any{
+		"level": "info",
+		"msg":   "hello world",
+		"user":  map[string]any{"id": float64(1)},
+		"empty": "",
+		"@ts":   float64(1760600000),
+		"n":     float64(42),
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "Fields", query: ".level .user", want: `level=info user={"id":1}`},
+		{name: "Single Field", query: ".level", want: "level=info"},
+		{name: "Nested Path", query: ".user.id .n", want: "user.id=1 n=42"},
+		{name: "Quoted Values", query: ".msg .empty", want: `msg="hello world" empty=""`},
+		{name: "Missing Field", query: ".nope", want: "nope=null"},
+		{name: "At Field", query: ".@ts|time", want: "@ts=2025-10-16T07:33:20Z"},
+		{name: "Label And Default", query: "lvl=.level id=.user.name?:-", want: "lvl=info id=-"},
+		{name: "Bracketed Key", query: `.user["id"]`, want: `user["id"]=1`},
+		// gojq keeps object keys sorted
+		{name: "Whole Record", query: ".", want: `@ts=1760600000 empty="" level=info msg="hello world" n=42 user={"id":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformed := SmartQueryKeyValue(tt.query)
+			query, err := gojq.Parse(transformed)
+			if err != nil {
+				t.Fatalf("SmartQueryKeyValue(%q) = %q is not valid jq: %v", tt.query, transformed, err)
+			}
+			v, ok := query.Run(input).Next()
+			if !ok {
+				t.Fatalf("SmartQueryKeyValue(%q) = %q produced no output", tt.query, transformed)
+			}
+			if err, isErr := v.(error); isErr {
+				t.Fatalf("SmartQueryKeyValue(%q) = %q failed: %v", tt.query, transformed, err)
+			}
+			if v != tt.want {
+				t.Errorf("SmartQueryKeyValue(%q) evaluates to %q, want %q", tt.query, v, tt.want)
+			}
+		})
+	}
+
+	// Plain jq is left alone
+	if q := ".items[] | .name"; SmartQueryKeyValue(q) != q {
+		t.Errorf("SmartQueryKeyValue(%q) = %q, want unchanged", q, SmartQueryKeyValue(q))
+	}
+}
@@ -0,0 +1,164 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSampleKey is the field hashed by --sample when --sample-key is not given.
+// Hashing a trace id keeps every line of a sampled trace together.
+const defaultSampleKey = "trace_id"
+
+// SampleRate keeps N out of every M log lines. The zero value disables sampling.
+type SampleRate struct {
+	N int
+	M int
+}
+
+// Enabled reports whether the rate actually drops anything.
+func (s SampleRate) Enabled() bool {
+	return s.M > 0 && s.N < s.M
+}
+
+// ParseSampleRate parses a fraction like "1/100".
+func ParseSampleRate(s string) (SampleRate, error) {
+	n, m, ok := strings.Cut(s, "/")
+	if !ok {
+		return SampleRate{}, fmt.Errorf("expects a fraction like 1/100, got: %q", s)
+	}
+	num, err1 := strconv.Atoi(n)
+	den, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || num <= 0 || den <= 0 || num > den {
+		return SampleRate{}, fmt.Errorf("expects a fraction like 1/100 with 0 < n <= m, got: %q", s)
+	}
+	return SampleRate{N: num, M: den}, nil
+}
+
+// Sampler decides deterministically which lines to keep.
+// JSON lines are hashed by the value of their key field, so all lines sharing a key
+// (e.g. a trace id) are kept or dropped together. Lines without the key, and plain
+// text lines, are hashed by their full content.
+type Sampler struct {
+	rate SampleRate
+	key  string
+}
+
+// NewSampler creates a sampler for the given rate, hashing the given key field.
+func NewSampler(rate SampleRate, key string) *Sampler {
+	if key == "" {
+		key = defaultSampleKey
+	}
+	return &Sampler{rate: rate, key: key}
+}
+
+// Keep reports whether the line is part of the sample.
+func (s *Sampler) Keep(line []byte, isJSON bool) bool {
+	h := fnv.New64a()
+	h.Write(s.hashInput(line, isJSON))
+	return h.Sum64()%uint64(s.rate.M) < uint64(s.rate.N)
+}
+
+func (s *Sampler) hashInput(line []byte, isJSON bool) []byte {
+	if !isJSON {
+		return line
+	}
+	var record any
+	if err := json.Unmarshal(line, &record); err != nil {
+		return line
+	}
+	v, ok := lookupField(record, s.key)
+	if !ok || v == nil {
+		return line
+	}
+	if str, ok := v.(string); ok {
+		return []byte(str)
+	}
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// RateLimit caps the output at Count lines per Per. The zero value disables limiting.
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// Enabled reports whether a limit is configured.
+func (r RateLimit) Enabled() bool {
+	return r.Count > 0 && r.Per > 0
+}
+
+// ParseRateLimit parses a rate like "200/s", "1000/m" or "50/500ms".
+func ParseRateLimit(s string) (RateLimit, error) {
+	n, unit, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("expects a rate like 200/s, got: %q", s)
+	}
+	count, err := strconv.Atoi(n)
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("expects a positive line count, got: %q", s)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		per, err = time.ParseDuration(unit)
+		if err != nil || per <= 0 {
+			return RateLimit{}, fmt.Errorf("expects a unit of s, m, h or a duration, got: %q", s)
+		}
+	}
+	return RateLimit{Count: count, Per: per}, nil
+}
+
+// RateLimiter enforces a RateLimit over fixed windows and counts what it drops.
+type RateLimiter struct {
+	limit   RateLimit
+	now     func() time.Time
+	start   time.Time
+	count   int
+	dropped int
+}
+
+// NewRateLimiter creates a limiter for the given limit.
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{limit: limit, now: time.Now}
+}
+
+// Allow reports whether another line fits into the current window.
+// When a new window starts, it also returns how many lines the previous window dropped,
+// so the caller can print a notice.
+func (l *RateLimiter) Allow() (ok bool, dropped int) {
+	now := l.now()
+	if l.start.IsZero() || now.Sub(l.start) >= l.limit.Per {
+		dropped = l.Flush()
+		l.start = now
+		l.count = 0
+	}
+	if l.count >= l.limit.Count {
+		l.dropped++
+		return false, dropped
+	}
+	l.count++
+	return true, dropped
+}
+
+// Remaining returns how long until the current window ends.
+func (l *RateLimiter) Remaining() time.Duration {
+	return l.start.Add(l.limit.Per).Sub(l.now())
+}
+
+// Flush returns the number of lines dropped since the last report and resets the counter.
+func (l *RateLimiter) Flush() int {
+	dropped := l.dropped
+	l.dropped = 0
+	return dropped
+}
@@ -0,0 +1,126 @@
+package jqlogs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseSampleRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SampleRate
+		wantErr bool
+	}{
+		{input: "1/100", want: SampleRate{N: 1, M: 100}},
+		{input: "3/4", want: SampleRate{N: 3, M: 4}},
+		{input: "1/1", want: SampleRate{N: 1, M: 1}},
+		{input: "100", wantErr: true},
+		{input: "0/10", wantErr: true},
+		{input: "5/4", wantErr: true},
+		{input: "a/b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSampleRate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSampleRate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSampleRate(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    RateLimit
+		wantErr bool
+	}{
+		{input: "200/s", want: RateLimit{Count: 200, Per: time.Second}},
+		{input: "1000/m", want: RateLimit{Count: 1000, Per: time.Minute}},
+		{input: "50/500ms", want: RateLimit{Count: 50, Per: 500 * time.Millisecond}},
+		{input: "200", wantErr: true},
+		{input: "-1/s", wantErr: true},
+		{input: "10/fortnight", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRateLimit(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRateLimit(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampler_KeepsTracesTogether(t *testing.T) {
+	sampler := NewSampler(SampleRate{N: 1, M: 4}, "")
+
+	kept := 0
+	for i := 0; i < 200; i++ {
+		traceID := fmt.Sprintf("trace-%d", i)
+		first := sampler.Keep([]byte(fmt.Sprintf(`{"trace_id":%q,"msg":"start"}`, traceID)), true)
+		second := sampler.Keep([]byte(fmt.Sprintf(`{"msg":"end","trace_id":%q}`, traceID)), true)
+		if first != second {
+			t.Fatalf("lines of %s were split by the sampler", traceID)
+		}
+		if first {
+			kept++
+		}
+	}
+
+	// 1/4 of 200 traces, with generous slack for hash distribution
+	if kept < 25 || kept > 75 {
+		t.Errorf("kept %d of 200 traces, want roughly 50", kept)
+	}
+}
+
+func TestSampler_CustomKey(t *testing.T) {
+	sampler := NewSampler(SampleRate{N: 1, M: 2}, ".req.id")
+
+	a := sampler.Keep([]byte(`{"req":{"id":42},"msg":"a"}`), true)
+	b := sampler.Keep([]byte(`{"req":{"id":42},"msg":"b"}`), true)
+	if a != b {
+		t.Errorf("lines with the same .req.id were split by the sampler")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimit{Count: 2, Per: time.Second})
+	limiter.now = func() time.Time { return clock }
+
+	var allowed []bool
+	for i := 0; i < 5; i++ {
+		ok, dropped := limiter.Allow()
+		if dropped != 0 {
+			t.Errorf("unexpected drop report %d in first window", dropped)
+		}
+		allowed = append(allowed, ok)
+	}
+	if fmt.Sprint(allowed) != "[true true false false false]" {
+		t.Errorf("allowed = %v, want the first 2 lines only", allowed)
+	}
+
+	// Next window reports what the previous one dropped
+	clock = clock.Add(time.Second)
+	ok, dropped := limiter.Allow()
+	if !ok || dropped != 3 {
+		t.Errorf("Allow() in new window = %v, %d, want true, 3", ok, dropped)
+	}
+	clock = clock.Add(300 * time.Millisecond)
+	if d := limiter.Remaining(); d != 700*time.Millisecond {
+		t.Errorf("Remaining() = %v, want 700ms", d)
+	}
+	if n := limiter.Flush(); n != 0 {
+		t.Errorf("Flush() = %d, want 0", n)
+	}
+}
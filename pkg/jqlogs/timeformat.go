@@ -0,0 +1,232 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Named --time-format values. Any other value is a layout, see ParseTimeFormat.
+const (
+	TimeFormatLocal    = "local"
+	TimeFormatUTC      = "utc"
+	TimeFormatRelative = "relative"
+)
+
+// DefaultTimeFields are the keys rewritten by --time-format when --time-fields is not given.
+var DefaultTimeFields = []string{"ts", "time", "timestamp", "@timestamp", "datetime", "eventTime"}
+
+// goLayoutReplacer translates Go reference layout elements into strftime directives.
+// Longer elements come first so that e.g. "2006" wins over "06".
+var goLayoutReplacer = strings.NewReplacer(
+	"January", "%B", "Monday", "%A", "Jan", "%b", "Mon", "%a",
+	"2006", "%Y", "-07:00", "%z", "Z07:00", "%z", "-0700", "%z", "Z0700", "%z", "MST", "%Z",
+	"01", "%m", "02", "%d", "15", "%H", "03", "%I", "04", "%M", "05", "%S", "PM", "%p", "06", "%y",
+)
+
+// goFractionRegexp matches the fractional seconds of a Go reference layout: ".000" prints
+// that many digits, ".999" as many but without trailing zeros. A comma works like the dot.
+var goFractionRegexp = regexp.MustCompile(`[.,](0{1,9}|9{1,9})`)
+
+// fractionDirectiveRegexp matches the fractional second directives of a layout: %N for
+// nanoseconds, %3N for the first 3 digits (like GNU date), and %.3N (%,3N) which jqlogs
+// uses for Go's ".999": the separator and the digits without trailing zeros, if any.
+// %% is matched too, so that "%%N" stays a literal.
+var fractionDirectiveRegexp = regexp.MustCompile(`%%|%([.,])?([1-9])?N`)
+
+// jqEpochDef turns a timestamp into seconds since epoch, or null if it is not one.
+// Numbers are seconds, millis, micros or nanos (guessed by magnitude, like the Smart Query
+// time formatter); strings are RFC3339 variants: "T" or space, optional fraction, "Z" or offset
+// (with or without colon), or no zone at all (taken as UTC).
+const jqEpochDef = `def _jqlogs_epoch: if type == "number" then (if . > 1e17 then . / 1e9 elif . > 1e14 then . / 1e6 elif . > 1e11 then . / 1e3 else . end | if . >= 1e8 then . else null end) ` +
+	`elif type == "string" then ((capture("^(?<d>[0-9]{4}-[0-9]{2}-[0-9]{2})[Tt ](?<t>[0-9]{2}:[0-9]{2}:[0-9]{2})(?<f>[.,][0-9]+)?(?<z>[Zz]|[+-][0-9]{2}:?[0-9]{2})?$") // null) ` +
+	`| if . == null then null else (.d + "T" + .t + (.z // "Z" | ascii_upcase) | fromdateiso8601) + (.f // ".0" | "0." + .[1:] | tonumber) end) ` +
+	`else null end;`
+
+// timestampRegexp matches the timestamp strings understood by jqEpochDef.
+var timestampRegexp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})[Tt ](\d{2}:\d{2}:\d{2})([.,]\d+)?([Zz]|[+-]\d{2}:?\d{2})?$`)
+
+// parseTimestamp is jqEpochDef in Go: it reads the time of a JSON value, if it is a timestamp.
+func parseTimestamp(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return parseTimestamp(f)
+	case float64:
+		switch {
+		case v > 1e17:
+			v /= 1e9
+		case v > 1e14:
+			v /= 1e6
+		case v > 1e11:
+			v /= 1e3
+		}
+		if v < 1e8 || math.IsInf(v, 0) {
+			return time.Time{}, false
+		}
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9/1e6))*1e6).UTC(), true
+	case string:
+		m := timestampRegexp.FindStringSubmatch(v)
+		if m == nil {
+			return time.Time{}, false
+		}
+		zone := strings.ToUpper(m[4])
+		if zone == "" {
+			zone = "Z"
+		} else if len(zone) == 5 {
+			zone = zone[:3] + ":" + zone[3:]
+		}
+		t, err := time.Parse(time.RFC3339Nano, m[1]+"T"+m[2]+strings.Replace(m[3], ",", ".", 1)+zone)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// recordTime returns the time of a JSON record line, from the first of fields holding a
+// timestamp at its top level. Records unwrapped by the Runner are looked into.
+func recordTime(line []byte, fields []string) (time.Time, bool) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var record map[string]any
+	if dec.Decode(&record) != nil {
+		return time.Time{}, false
+	}
+	if inner, ok := record[envelopeRecordKey].(map[string]any); ok && record[envelopeKey] != nil {
+		record = inner
+	}
+	for _, field := range fields {
+		if v, ok := record[field]; ok {
+			if t, ok := parseTimestamp(v); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseTimeFormat validates a --time-format value. Besides local, utc and relative it accepts
+// a strftime layout ("%H:%M:%S") or a Go reference layout ("15:04:05"), both printed in local time.
+func ParseTimeFormat(format string) error {
+	_, err := timeLayout(format)
+	return err
+}
+
+// timeLayout returns the strftime layout for a custom --time-format, or "" for the named ones.
+func timeLayout(format string) (string, error) {
+	switch format {
+	case TimeFormatLocal, TimeFormatUTC, TimeFormatRelative:
+		return "", nil
+	case "":
+		return "", fmt.Errorf("requires local, utc, relative or a layout")
+	}
+	if strings.Contains(format, "%") {
+		return format, nil
+	}
+	layout := goLayoutReplacer.Replace(goFractions(format))
+	if !strings.Contains(layout, "%") {
+		return "", fmt.Errorf("requires local, utc, relative or a layout such as \"15:04:05\" or \"%%H:%%M:%%S\", got: %q", format)
+	}
+	return layout, nil
+}
+
+// goFractions translates the fractional seconds of a Go reference layout into %3N (".000")
+// or %.3N (".999") directives. Like Go, a run of zeros or nines followed by another digit
+// is not a fraction.
+func goFractions(format string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range goFractionRegexp.FindAllStringSubmatchIndex(format, -1) {
+		if m[1] < len(format) && '0' <= format[m[1]] && format[m[1]] <= '9' {
+			continue
+		}
+		sep, digits := format[m[0]:m[2]], m[3]-m[2]
+		b.WriteString(format[last:m[0]])
+		if format[m[2]] == '0' {
+			fmt.Fprintf(&b, "%s%%%dN", sep, digits)
+		} else {
+			fmt.Fprintf(&b, "%%%s%dN", sep, digits)
+		}
+		last = m[1]
+	}
+	b.WriteString(format[last:])
+	return b.String()
+}
+
+// jqLayoutRender returns the jq expression printing epoch seconds with a strftime layout.
+// strftime only knows whole seconds, so the fractional second directives are rendered
+// separately, from the epoch rounded to microseconds.
+func jqLayoutRender(layout string) string {
+	var parts []string
+	literal := func(s string) {
+		if s != "" {
+			lit, _ := json.Marshal(s)
+			parts = append(parts, fmt.Sprintf("($s | strflocaltime(%s))", lit))
+		}
+	}
+	last := 0
+	for _, m := range fractionDirectiveRegexp.FindAllStringSubmatchIndex(layout, -1) {
+		if layout[m[0]:m[1]] == "%%" {
+			continue
+		}
+		literal(layout[last:m[0]])
+		last = m[1]
+		digits := "9"
+		if m[4] >= 0 {
+			digits = layout[m[4]:m[5]]
+		}
+		frac := fmt.Sprintf(`$frac[:%s]`, digits)
+		if m[2] >= 0 {
+			sep, _ := json.Marshal(layout[m[2]:m[3]])
+			frac = fmt.Sprintf(`(%s | sub("0+$"; "") | if . == "" then "" else %s + . end)`, frac, sep)
+		}
+		parts = append(parts, frac)
+	}
+	literal(layout[last:])
+	if len(parts) == 0 {
+		return `""`
+	}
+	// $s: whole seconds, $frac: the 9 digits of the fraction
+	return `(. * 1e6 | round) as $us | ($us / 1e6 | floor) as $s | ("00000\($us % 1000000)" | .[-6:] + "000") as $frac | ` +
+		strings.Join(parts, " + ")
+}
+
+// jqTimeDefs returns the jq definitions of _jqlogs_times, which rewrites the values of the
+// time fields, at any depth, into the given format. Values that are not timestamps are kept.
+func jqTimeDefs(format string, fields []string) string {
+	// $ms: rounded epoch millis, $s: whole seconds, $frac: ".123" or "" for whole seconds
+	split := `(. * 1000 | round) as $ms | ($ms / 1000 | floor) as $s | ($ms % 1000 | if . == 0 then "" else "." + ("00\(.)" | .[-3:]) end) as $frac`
+	var render string
+	switch format {
+	case TimeFormatUTC:
+		render = split + ` | ($s | strftime("%Y-%m-%dT%H:%M:%S")) + $frac + "Z"`
+	case TimeFormatLocal:
+		render = split + ` | ($s | strflocaltime("%Y-%m-%dT%H:%M:%S")) + $frac + ($s | strflocaltime("%z") | .[0:3] + ":" + .[3:])`
+	case TimeFormatRelative:
+		render = `(now - .) as $d | ($d | fabs) as $a | if $a < 1 then "now" else ` +
+			`(if $a < 60 then "\($a | floor)s" elif $a < 3600 then "\($a / 60 | floor)m" elif $a < 86400 then "\($a / 3600 | floor)h" else "\($a / 86400 | floor)d" end) ` +
+			`+ (if $d >= 0 then " ago" else " from now" end) end`
+	default:
+		layout, _ := timeLayout(format)
+		render = jqLayoutRender(layout)
+	}
+	names, _ := json.Marshal(fields)
+	return jqEpochDef +
+		` def _jqlogs_time: _jqlogs_epoch as $t | if $t == null then . else ($t | ` + render + `) end;` +
+		` def _jqlogs_times: walk(if type == "object" then with_entries(if .key | IN(` + string(names) + `[]) then .value |= _jqlogs_time else . end) else . end);`
+}
+
+// timeFields returns the configured time fields, or the built-in defaults.
+func (o JqFlagOptions) timeFields() []string {
+	if len(o.TimeFields) > 0 {
+		return o.TimeFields
+	}
+	return DefaultTimeFields
+}
@@ -0,0 +1,168 @@
+package jqlogs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/itchyny/gojq"
+)
+
+// runTimes applies _jqlogs_times with the given format and fields to input
+func runTimes(t *testing.T, format string, fields []string, input any) any {
+	t.Helper()
+	query, err := gojq.Parse(jqTimeDefs(format, fields) + " _jqlogs_times")
+	if err != nil {
+		t.Fatalf("jqTimeDefs(%q) is not valid jq: %v", format, err)
+	}
+	v, ok := query.Run(input).Next()
+	if !ok {
+		t.Fatalf("jqTimeDefs(%q) produced no output", format)
+	}
+	if err, isErr := v.(error); isErr {
+		t.Fatalf("jqTimeDefs(%q) failed: %v", format, err)
+	}
+	return v
+}
+
+func TestJqTimeDefs(t *testing.T) {
+	saved := time.Local
+	time.Local = time.FixedZone("UTC+8", 8*60*60)
+	defer func() { time.Local = saved }()
+
+	tests := []struct {
+		name   string
+		format string
+		value  any
+		want   any
+	}{
+		{name: "Seconds", format: TimeFormatUTC, value: float64(1760600000), want: "2025-10-16T07:33:20Z"},
+		{name: "Millis", format: TimeFormatUTC, value: float64(1760600000123), want: "2025-10-16T07:33:20.123Z"},
+		{name: "Micros", format: TimeFormatUTC, value: float64(1760600000123456), want: "2025-10-16T07:33:20.123Z"},
+		{name: "Nanos", format: TimeFormatUTC, value: float64(1760600000123456789), want: "2025-10-16T07:33:20.123Z"},
+		{name: "RFC3339", format: TimeFormatUTC, value: "2025-10-16T15:33:20+08:00", want: "2025-10-16T07:33:20Z"},
+		{name: "RFC3339 Nano", format: TimeFormatUTC, value: "2025-10-16T07:33:20.123456789Z", want: "2025-10-16T07:33:20.123Z"},
+		{name: "Space And Offset Without Colon", format: TimeFormatUTC, value: "2025-10-16 15:33:20,5+0800", want: "2025-10-16T07:33:20.500Z"},
+		{name: "No Zone Is UTC", format: TimeFormatUTC, value: "2025-10-16T07:33:20", want: "2025-10-16T07:33:20Z"},
+		{name: "Local", format: TimeFormatLocal, value: float64(1760600000123), want: "2025-10-16T15:33:20.123+08:00"},
+		{name: "Go Layout", format: "2006-01-02 15:04:05", value: float64(1760600000), want: "2025-10-16 15:33:20"},
+		{name: "Strftime Layout", format: "%H:%M:%S", value: "2025-10-16T07:33:20Z", want: "15:33:20"},
+		{name: "Go Millis", format: "15:04:05.000", value: float64(1760600000123456), want: "15:33:20.123"},
+		{name: "Go Millis Of Whole Second", format: "15:04:05.000", value: float64(1760600000), want: "15:33:20.000"},
+		{name: "Go Comma Micros", format: "15:04:05,000000", value: "2025-10-16T07:33:20.1234567Z", want: "15:33:20,123457"},
+		{name: "Go Trimmed Fraction", format: "15:04:05.999999", value: "2025-10-16T07:33:20.5Z", want: "15:33:20.5"},
+		{name: "Go Trimmed Whole Second", format: "15:04:05.999", value: float64(1760600000), want: "15:33:20"},
+		{name: "Strftime Nanos", format: "%H:%M:%S.%N", value: "2025-10-16T07:33:20.25Z", want: "15:33:20.250000000"},
+		{name: "Strftime Millis", format: "%S.%3N", value: float64(1760600000987), want: "20.987"},
+		{name: "Strftime Escaped Percent", format: "%S %%N", value: float64(1760600000), want: "20 %N"},
+		{name: "Not A Timestamp", format: TimeFormatUTC, value: "yesterday", want: "yesterday"},
+		{name: "Small Number Is Kept", format: TimeFormatUTC, value: float64(42), want: float64(42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runTimes(t, tt.format, DefaultTimeFields, map[string]any{"ts": tt.value})
+			if want := map[string]any{"ts": tt.want}; !reflect.DeepEqual(got, want) {
+				t.Errorf("ts %v = %v, want %v", tt.value, got, want)
+			}
+		})
+	}
+}
+
+func TestJqTimeDefs_Relative(t *testing.T) {
+	now := float64(time.Now().Unix())
+	got := runTimes(t, TimeFormatRelative, DefaultTimeFields, []any{
+		map[string]any{"ts": now - 90},
+		map[string]any{"ts": now - 3*3600},
+		map[string]any{"ts": now + 2*86400 + 60},
+	})
+	want := []any{
+		map[string]any{"ts": "1m ago"},
+		map[string]any{"ts": "3h ago"},
+		map[string]any{"ts": "2d from now"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("relative = %v, want %v", got, want)
+	}
+}
+
+func TestJqTimeDefs_Fields(t *testing.T) {
+	input := map[string]any{
+		"created": float64(1760600000),
+		"ts":      float64(1760600000),
+		"nested":  map[string]any{"created": "2025-10-16T07:33:20Z"},
+	}
+	got := runTimes(t, TimeFormatUTC, []string{"created"}, input)
+	want := map[string]any{
+		"created": "2025-10-16T07:33:20Z",
+		"ts":      float64(1760600000),
+		"nested":  map[string]any{"created": "2025-10-16T07:33:20Z"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("_jqlogs_times = %v, want %v", got, want)
+	}
+}
+
+func TestParseTimeFormat(t *testing.T) {
+	for _, format := range []string{"local", "utc", "relative", "15:04:05", "Jan 2 15:04:05", "%H:%M"} {
+		if err := ParseTimeFormat(format); err != nil {
+			t.Errorf("ParseTimeFormat(%q) unexpected error: %v", format, err)
+		}
+	}
+	for _, format := range []string{"", "nope", "UTC"} {
+		if err := ParseTimeFormat(format); err == nil {
+			t.Errorf("ParseTimeFormat(%q) expected error", format)
+		}
+	}
+
+	layouts := map[string]string{
+		"2006-01-02T15:04:05 MST": "%Y-%m-%dT%H:%M:%S %Z",
+		"15:04:05.000":            "%H:%M:%S.%3N",
+		"15:04:05,999999":         "%H:%M:%S%,6N",
+		"15:04:05.0001":           "%H:%M:%S.00%m",
+	}
+	for format, want := range layouts {
+		if got, _ := timeLayout(format); got != want {
+			t.Errorf("timeLayout(%q) = %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestRecordTime(t *testing.T) {
+	want := time.Date(2026, 1, 2, 3, 4, 5, 250e6, time.UTC)
+	tests := []struct {
+		name   string
+		line   string
+		fields []string
+		ok     bool
+	}{
+		{name: "RFC3339", line: `{"ts":"2026-01-02T03:04:05.25Z"}`, ok: true},
+		{name: "Offset Without Colon", line: `{"ts":"2026-01-02 05:04:05,250+0200"}`, ok: true},
+		{name: "No Zone Is UTC", line: `{"ts":"2026-01-02T03:04:05.250"}`, ok: true},
+		{name: "Epoch Seconds", line: `{"ts":1767323045.25}`, ok: true},
+		{name: "Epoch Millis", line: `{"ts":1767323045250}`, ok: true},
+		{name: "Epoch Nanos", line: `{"ts":1767323045250000000}`, ok: true},
+		{name: "First Field Holding A Timestamp", line: `{"time":"soon","ts":"2026-01-02T03:04:05.25Z"}`, fields: []string{"time", "ts"}, ok: true},
+		{name: "Unwrapped Record", line: `{"__jqlogs_envelope":{},"__jqlogs_record":{"ts":"2026-01-02T03:04:05.25Z"}}`, ok: true},
+		{name: "Small Number", line: `{"ts":42}`},
+		{name: "Not A Timestamp", line: `{"ts":"yesterday"}`},
+		{name: "No Time Field", line: `{"msg":"hi"}`},
+		{name: "Not An Object", line: `[1,2]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := tt.fields
+			if fields == nil {
+				fields = DefaultTimeFields
+			}
+			got, ok := recordTime([]byte(tt.line), fields)
+			if ok != tt.ok {
+				t.Fatalf("recordTime(%s) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+			if ok && !got.Equal(want) {
+				t.Errorf("recordTime(%s) = %v, want %v", tt.line, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// DefaultTraceFields are the fields holding the trace or request ID matched by --trace-id
+// when --trace-fields is not given.
+var DefaultTraceFields = []string{"traceparent", "trace_id", "x-request-id"}
+
+// traceparentRegexp matches a W3C traceparent header: version-traceid-parentid-flags.
+var traceparentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// traceFields returns the configured trace fields, or the built-in defaults.
+func (o JqFlagOptions) traceFields() []string {
+	if len(o.TraceFields) > 0 {
+		return o.TraceFields
+	}
+	return DefaultTraceFields
+}
+
+// traceMatcher keeps the records of one trace or request (--trace-id): JSON records with the
+// ID in one of the trace fields, at any depth, and text lines mentioning it.
+type traceMatcher struct {
+	id     string
+	fields map[string]bool // lower case, header names are matched case-insensitively
+}
+
+func newTraceMatcher(id string, fields []string) *traceMatcher {
+	m := &traceMatcher{id: id, fields: make(map[string]bool, len(fields))}
+	for _, field := range fields {
+		m.fields[strings.ToLower(field)] = true
+	}
+	return m
+}
+
+// match reports whether the line belongs to the trace.
+func (m *traceMatcher) match(line []byte, isJSON bool) bool {
+	if isJSON {
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var record any
+		if err := dec.Decode(&record); err == nil {
+			return m.matchValue(record, false)
+		}
+	}
+	return bytes.Contains(line, []byte(m.id))
+}
+
+// matchValue walks v for a trace field holding the ID. inField is set below a trace field,
+// where arrays hold several values (e.g. HTTP headers).
+func (m *traceMatcher) matchValue(v any, inField bool) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if m.matchValue(value, m.fields[strings.ToLower(key)]) {
+				return true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if m.matchValue(value, inField) {
+				return true
+			}
+		}
+	case string:
+		return inField && m.matchID(v)
+	case json.Number:
+		return inField && string(v) == m.id
+	}
+	return false
+}
+
+// matchID compares a trace field value to the ID; a traceparent matches by its trace ID.
+func (m *traceMatcher) matchID(value string) bool {
+	if strings.EqualFold(value, m.id) {
+		return true
+	}
+	if sub := traceparentRegexp.FindStringSubmatch(strings.ToLower(value)); sub != nil {
+		return strings.EqualFold(sub[1], m.id)
+	}
+	return false
+}
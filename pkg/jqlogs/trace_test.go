@@ -0,0 +1,37 @@
+package jqlogs
+
+import "testing"
+
+func TestTraceMatcher(t *testing.T) {
+	const id = "4bf92f3577b34da6a3ce929d0e0e4736"
+	m := newTraceMatcher(id, DefaultTraceFields)
+
+	tests := []struct {
+		name   string
+		line   string
+		isJSON bool
+		want   bool
+	}{
+		{name: "Trace ID Field", line: `{"trace_id":"` + id + `"}`, isJSON: true, want: true},
+		{name: "Other Trace", line: `{"trace_id":"0af7651916cd43dd8448eb211c80319c"}`, isJSON: true, want: false},
+		{name: "Traceparent", line: `{"traceparent":"00-` + id + `-00f067aa0ba902b7-01"}`, isJSON: true, want: true},
+		{name: "Nested Header Case-Insensitive", line: `{"req":{"headers":{"X-Request-Id":["` + id + `"]}}}`, isJSON: true, want: true},
+		{name: "ID Outside Trace Fields", line: `{"msg":"` + id + `"}`, isJSON: true, want: false},
+		{name: "Text Line Mentioning ID", line: "retrying " + id, want: true},
+		{name: "Text Line", line: "retrying", want: false},
+		{name: "Not JSON After All", line: "[" + id + "] failed", isJSON: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.match([]byte(tt.line), tt.isJSON); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+
+	// Numeric request IDs in a configured field
+	if m := newTraceMatcher("42", []string{"req"}); !m.match([]byte(`{"req":42}`), true) {
+		t.Error("match() = false for a numeric ID, want true")
+	}
+}
@@ -0,0 +1,652 @@
+package jqlogs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/itchyny/gojq"
+	"github.com/mattn/go-runewidth"
+)
+
+// tuiRedrawInterval throttles redraws while records stream in.
+const tuiRedrawInterval = 50 * time.Millisecond
+
+// ansiColors maps the level-colors names to ANSI foreground codes.
+var ansiColors = map[string]string{
+	"black": "30", "red": "31", "green": "32", "yellow": "33",
+	"blue": "34", "magenta": "35", "cyan": "36", "white": "37",
+}
+
+const tuiHelp = "q quit  : filter  / search  n/N next/prev  enter expand  p pause"
+
+// tuiRecord is one line of the stream, as kept in the --tui buffer.
+type tuiRecord struct {
+	line   string
+	isJSON bool
+	value  any    // decoded record for JSON lines that parse, else nil
+	level  string // lower-cased log level, "" if unknown
+}
+
+// newTUIRecord decodes a line coming out of the stream filter.
+func newTUIRecord(line string, isJSON bool, levelFields []string) tuiRecord {
+	rec := tuiRecord{line: line, isJSON: isJSON}
+	if !isJSON {
+		return rec
+	}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if dec.Decode(&rec.value) != nil {
+		rec.value = nil
+		return rec
+	}
+	// Records unwrapped by --unwrap carry their envelope next to them
+	if obj, ok := rec.value.(map[string]any); ok {
+		if inner, ok := obj[envelopeRecordKey]; ok {
+			rec.value = inner
+		}
+	}
+	for _, field := range levelFields {
+		if v, ok := lookupField(rec.value, field); ok && v != nil {
+			rec.level = strings.ToLower(fmt.Sprint(v))
+			break
+		}
+	}
+	return rec
+}
+
+// tuiRow is one output of the filter, shown as one line of the view.
+type tuiRow struct {
+	seq  int // sequence number of the record it came from
+	text string
+}
+
+type tuiMode int
+
+const (
+	tuiModeNormal tuiMode = iota
+	tuiModeFilter
+	tuiModeSearch
+)
+
+// tuiModel is the state of the --tui viewer. It knows nothing about the terminal:
+// keys go in through handleKey and screen lines come out of render.
+type tuiModel struct {
+	opts        JqFlagOptions
+	levelFields []string
+	levelColors map[string]string
+
+	// records[i] has sequence number first+i; evicted records keep their numbers
+	records    []tuiRecord
+	first      int
+	maxRecords int
+
+	filter      string
+	code        *gojq.Code
+	filterErr   error
+	rows        []tuiRow
+	savedFilter string // filter to restore when editing is cancelled
+
+	cursor   int
+	top      int
+	expanded bool
+	follow   bool
+
+	paused  bool
+	pending []tuiRecord
+
+	search string
+	mode   tuiMode
+	input  []rune
+
+	width, height int
+	ended         bool
+	notice        string // result of the last action, e.g. a failed search
+	warning       string // last line written to stderr, e.g. by kubectl
+}
+
+// newTUIModel creates a viewer filtering records with query.
+func newTUIModel(query string, opts JqFlagOptions, maxRecords int) (*tuiModel, error) {
+	m := &tuiModel{
+		opts:        opts,
+		levelFields: opts.levelFields(),
+		levelColors: opts.levelColors(),
+		maxRecords:  maxRecords,
+		follow:      true,
+		width:       80,
+		height:      24,
+	}
+	code, err := m.compile(query)
+	if err != nil {
+		return nil, err
+	}
+	m.filter, m.code = query, code
+	return m, nil
+}
+
+// compile builds the same program the jq process runs for query, so the view matches
+// the regular output (Smart Query, pre-processing, time format, ...).
+func (m *tuiModel) compile(query string) (*gojq.Code, error) {
+	return compileJq(query, m.opts)
+}
+
+// eval runs the filter on a record and returns its outputs as display texts.
+func (m *tuiModel) eval(rec tuiRecord) []string {
+	if !rec.isJSON {
+		return []string{rec.line}
+	}
+	var texts []string
+	iter := m.code.Run(rec.line)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		switch v := v.(type) {
+		case error:
+			texts = append(texts, "error: "+v.Error())
+		case string:
+			texts = append(texts, v)
+		default:
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				texts = append(texts, fmt.Sprint(v))
+			} else {
+				texts = append(texts, strings.TrimSuffix(buf.String(), "\n"))
+			}
+		}
+	}
+	return texts
+}
+
+// add appends a record from the stream, or queues it while paused.
+func (m *tuiModel) add(rec tuiRecord) {
+	if m.paused {
+		m.pending = append(m.pending, rec)
+		if len(m.pending) > m.maxRecords {
+			m.pending = m.pending[1:]
+		}
+		return
+	}
+	atEnd := m.follow && (len(m.rows) == 0 || m.cursor == len(m.rows)-1)
+
+	m.records = append(m.records, rec)
+	seq := m.first + len(m.records) - 1
+	for _, text := range m.eval(rec) {
+		m.rows = append(m.rows, tuiRow{seq: seq, text: text})
+	}
+	if len(m.records) > m.maxRecords {
+		m.evict(len(m.records) - m.maxRecords)
+	}
+	if atEnd && len(m.rows) > 0 {
+		m.cursor = len(m.rows) - 1
+	}
+}
+
+// evict drops the n oldest records and their rows.
+func (m *tuiModel) evict(n int) {
+	m.records = m.records[n:]
+	m.first += n
+	drop := 0
+	for drop < len(m.rows) && m.rows[drop].seq < m.first {
+		drop++
+	}
+	m.rows = m.rows[drop:]
+	m.cursor = max(m.cursor-drop, 0)
+	m.top = max(m.top-drop, 0)
+}
+
+// setFilter re-evaluates the buffer with a new query. An invalid query keeps the current rows.
+func (m *tuiModel) setFilter(query string) {
+	code, err := m.compile(query)
+	if err != nil {
+		m.filterErr = err
+		return
+	}
+	m.filter, m.code, m.filterErr = query, code, nil
+
+	selected := -1
+	if m.cursor < len(m.rows) {
+		selected = m.rows[m.cursor].seq
+	}
+	m.rows = m.rows[:0]
+	m.cursor, m.top = 0, 0
+	for i, rec := range m.records {
+		seq := m.first + i
+		for _, text := range m.eval(rec) {
+			if seq <= selected {
+				m.cursor = len(m.rows)
+			}
+			m.rows = append(m.rows, tuiRow{seq: seq, text: text})
+		}
+	}
+	if m.follow && len(m.rows) > 0 {
+		m.cursor = len(m.rows) - 1
+	}
+}
+
+// togglePause freezes the view; records arriving meanwhile are added on resume.
+func (m *tuiModel) togglePause() {
+	m.paused = !m.paused
+	if m.paused {
+		return
+	}
+	pending := m.pending
+	m.pending = nil
+	for _, rec := range pending {
+		m.add(rec)
+	}
+}
+
+// findNext moves the cursor to the next (or previous) row containing the search text.
+func (m *tuiModel) findNext(forward bool) {
+	if m.search == "" || len(m.rows) == 0 {
+		return
+	}
+	needle := strings.ToLower(m.search)
+	for i := 1; i <= len(m.rows); i++ {
+		idx := m.cursor + i
+		if !forward {
+			idx = m.cursor - i
+		}
+		idx = (idx%len(m.rows) + len(m.rows)) % len(m.rows)
+		if strings.Contains(strings.ToLower(m.rows[idx].text), needle) {
+			m.moveTo(idx)
+			m.notice = ""
+			return
+		}
+	}
+	m.notice = fmt.Sprintf("pattern not found: %s", m.search)
+}
+
+func (m *tuiModel) moveTo(idx int) {
+	m.cursor = min(max(idx, 0), max(len(m.rows)-1, 0))
+	m.follow = m.cursor == len(m.rows)-1
+}
+
+// handleKey applies a key press. It returns false when the viewer should quit.
+func (m *tuiModel) handleKey(k tuiKey) bool {
+	if k.name == "ctrl-c" {
+		return false
+	}
+	if m.mode != tuiModeNormal {
+		m.editKey(k)
+		return true
+	}
+	m.notice = ""
+	switch {
+	case k.r == 'q':
+		return false
+	case k.name == "down" || k.r == 'j':
+		m.moveTo(m.cursor + 1)
+	case k.name == "up" || k.r == 'k':
+		m.moveTo(m.cursor - 1)
+	case k.name == "pgdn" || k.r == 'f':
+		m.moveTo(m.cursor + m.bodyHeight())
+	case k.name == "pgup" || k.r == 'b':
+		m.moveTo(m.cursor - m.bodyHeight())
+	case k.name == "home" || k.r == 'g':
+		m.moveTo(0)
+	case k.name == "end" || k.r == 'G':
+		m.moveTo(len(m.rows) - 1)
+	case k.name == "enter":
+		m.expanded = !m.expanded
+	case k.name == "esc":
+		m.expanded = false
+	case k.r == 'p' || k.r == ' ':
+		m.togglePause()
+	case k.r == ':':
+		m.mode, m.input, m.savedFilter = tuiModeFilter, []rune(m.filter), m.filter
+	case k.r == '/':
+		m.mode, m.input = tuiModeSearch, nil
+	case k.r == 'n':
+		m.findNext(true)
+	case k.r == 'N':
+		m.findNext(false)
+	}
+	return true
+}
+
+// editKey edits the filter or search bar. The filter is re-evaluated as it is typed.
+func (m *tuiModel) editKey(k tuiKey) {
+	switch {
+	case k.name == "esc":
+		if m.mode == tuiModeFilter {
+			m.setFilter(m.savedFilter)
+		}
+		m.mode = tuiModeNormal
+		return
+	case k.name == "enter":
+		if m.mode == tuiModeSearch {
+			m.search = string(m.input)
+			m.mode = tuiModeNormal
+			m.findNext(true)
+			return
+		}
+		if m.filterErr == nil {
+			m.mode = tuiModeNormal
+		}
+		return
+	case k.name == "backspace":
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case k.name == "ctrl-u":
+		m.input = nil
+	case k.r != 0:
+		m.input = append(m.input, k.r)
+	default:
+		return
+	}
+	if m.mode == tuiModeFilter {
+		m.setFilter(string(m.input))
+	}
+}
+
+func (m *tuiModel) bodyHeight() int {
+	return max(m.height-2, 1)
+}
+
+// expansion returns the lines shown under the selected row: the record as pretty JSON.
+func (m *tuiModel) expansion() []string {
+	if !m.expanded || m.cursor >= len(m.rows) {
+		return nil
+	}
+	rec := m.records[m.rows[m.cursor].seq-m.first]
+	if rec.value == nil {
+		return strings.Split(rec.line, "\n")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rec.value); err != nil {
+		return []string{rec.line}
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// render returns the screen: the filter bar, the rows and the status bar, one string per line.
+func (m *tuiModel) render() []string {
+	lines := make([]string, 0, m.height)
+
+	// Filter bar
+	switch m.mode {
+	case tuiModeFilter:
+		bar := "filter: " + string(m.input) + "█"
+		if m.filterErr != nil {
+			bar += "  " + m.color("red", m.filterErr.Error())
+		}
+		lines = append(lines, m.fit(bar))
+	case tuiModeSearch:
+		lines = append(lines, m.fit("search: "+string(m.input)+"█"))
+	default:
+		lines = append(lines, m.fit(m.reverse("filter: "+m.filter)))
+	}
+
+	// Rows, keeping the cursor (and as much of its expansion as possible) visible
+	body := m.bodyHeight()
+	expansion := m.expansion()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+body {
+		m.top = m.cursor - body + 1
+	}
+	if len(expansion) > 0 && m.cursor-m.top+1+len(expansion) > body {
+		m.top = max(m.cursor-max(body-1-len(expansion), 0), 0)
+	}
+	for i := m.top; i < len(m.rows) && len(lines) < body+1; i++ {
+		lines = append(lines, m.renderRow(i))
+		if i == m.cursor {
+			for _, l := range expansion {
+				if len(lines) >= body+1 {
+					break
+				}
+				lines = append(lines, m.fit("    "+m.highlight(sanitize(l))))
+			}
+		}
+	}
+	for len(lines) < body+1 {
+		lines = append(lines, "~")
+	}
+
+	// Status bar
+	var status []string
+	if m.paused {
+		status = append(status, fmt.Sprintf("PAUSED +%d", len(m.pending)))
+	} else if m.ended {
+		status = append(status, "END")
+	}
+	position := 0
+	if len(m.rows) > 0 {
+		position = m.cursor + 1
+	}
+	status = append(status, fmt.Sprintf("%d/%d rows  %d records", position, len(m.rows), len(m.records)))
+	if m.search != "" {
+		status = append(status, "search: "+m.search)
+	}
+	if m.notice != "" {
+		status = append(status, m.notice)
+	} else if m.warning != "" {
+		status = append(status, m.warning)
+	} else {
+		status = append(status, tuiHelp)
+	}
+	lines = append(lines, m.fit(m.reverse(strings.Join(status, " | "))))
+	return lines
+}
+
+// renderRow renders one row in its level's color, marking the cursor and search matches.
+func (m *tuiModel) renderRow(i int) string {
+	row := m.rows[i]
+	text := sanitize(row.text)
+	marker := "  "
+	if i == m.cursor {
+		marker = "> "
+	}
+	level := m.records[row.seq-m.first].level
+	return m.fit(marker + m.color(m.levelColors[level], m.highlight(text)))
+}
+
+// highlight marks case-insensitive occurrences of the search text.
+func (m *tuiModel) highlight(text string) string {
+	if m.search == "" || m.opts.Monochrome {
+		return text
+	}
+	lower, needle := strings.ToLower(text), strings.ToLower(m.search)
+	if len(lower) != len(text) {
+		return text // case folding changed byte offsets
+	}
+	var b strings.Builder
+	for {
+		idx := strings.Index(lower, needle)
+		if idx < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		end := idx + len(needle)
+		b.WriteString(text[:idx] + highlightOn + text[idx:end] + highlightOff)
+		text, lower = text[end:], lower[end:]
+	}
+}
+
+func (m *tuiModel) color(name, text string) string {
+	code, ok := ansiColors[name]
+	if !ok || m.opts.Monochrome {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[39m"
+}
+
+func (m *tuiModel) reverse(text string) string {
+	if m.opts.Monochrome {
+		return text
+	}
+	return highlightOn + text + strings.Repeat(" ", max(m.width-runewidth.StringWidth(stripEscapes(text)), 0)) + highlightOff
+}
+
+// fit truncates a line to the terminal width, keeping escape sequences intact.
+func (m *tuiModel) fit(line string) string {
+	var b strings.Builder
+	width := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\x1b' {
+			end := skipEscape(line, i)
+			b.WriteString(line[i:end])
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		w := runewidth.RuneWidth(r)
+		if width+w > m.width {
+			b.WriteString("\x1b[0m")
+			break
+		}
+		b.WriteString(line[i : i+size])
+		width += w
+		i += size
+	}
+	return b.String()
+}
+
+// sanitize keeps log content from moving the cursor or changing colors: control
+// characters are shown escaped and multi-line values are folded into one line.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return '⏎'
+		case r == '\t':
+			return ' '
+		case r < 0x20 || r == 0x7f:
+			return '�'
+		}
+		return r
+	}, s)
+}
+
+// tuiStderr collects stderr (kubectl's and ours) while the viewer owns the screen.
+type tuiStderr struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *tuiStderr) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+// bytes returns everything written so far.
+func (s *tuiStderr) bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Clone(s.buf.Bytes())
+}
+
+// lastLine returns the last complete line written so far.
+func (s *tuiStderr) lastLine() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines := strings.Split(strings.TrimRight(s.buf.String(), "\n"), "\n")
+	return lines[len(lines)-1]
+}
+
+// RunTUI shows the stream in an interactive terminal viewer (--tui) instead of printing it.
+// Records go through the same stream filter as Run and are kept in a bounded buffer,
+// which is re-evaluated whenever the filter is edited. Returns exit code.
+func (r *Runner) RunTUI(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
+	if !isTerminal(os.Stdin) || !isTerminal(r.Stdout) {
+		fmt.Fprintf(r.Stderr, "Error: --tui requires an interactive terminal\n")
+		return 1
+	}
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	filter, err := newStreamFilter(opts)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	// The viewer keeps decoded records itself, bounded by --buffer; the oldest ones are dropped first
+	model, err := newTUIModel(jqQuery, opts, opts.bufferSize())
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: invalid query: %v\n", err)
+		return 1
+	}
+
+	term, err := openTUITerminal(os.Stdin, r.Stdout)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: --tui %v\n", err)
+		return 1
+	}
+	stderr := &tuiStderr{}
+	defer func() {
+		term.close()
+		r.Stderr.Write(stderr.bytes())
+	}()
+	model.width, model.height = term.size()
+
+	// Stream records in the background; the viewer may quit before kubectl is done
+	records := make(chan tuiRecord, 1024)
+	done := make(chan struct{})
+	defer close(done)
+	streamer := *r
+	streamer.Stderr = stderr
+	go func() {
+		defer close(records)
+		levelFields := opts.levelFields()
+		streamer.stream(kubectlArgs, filter, func(line []byte, _ int, isJSON bool) {
+			select {
+			case records <- newTUIRecord(string(line), isJSON, levelFields):
+			case <-done:
+			}
+		})
+	}()
+
+	keys := term.keys()
+	resized := term.resizes()
+	ticker := time.NewTicker(tuiRedrawInterval)
+	defer ticker.Stop()
+
+	dirty := true
+	for {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				records = nil
+				model.ended = true
+			} else {
+				model.add(rec)
+			}
+			dirty = true
+		case k, ok := <-keys:
+			if !ok || !model.handleKey(k) {
+				return 0
+			}
+			term.draw(model.render())
+			dirty = false
+		case <-resized:
+			model.width, model.height = term.size()
+			dirty = true
+		case <-ticker.C:
+			if line := stderr.lastLine(); line != model.warning {
+				model.warning = line
+				dirty = true
+			}
+			if dirty {
+				term.draw(model.render())
+				dirty = false
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package jqlogs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// tuiKey is a decoded key press: a printable rune, or a name for special keys.
+type tuiKey struct {
+	r    rune
+	name string
+}
+
+// escapeKeys maps the escape sequences of special keys to their names.
+var escapeKeys = map[string]string{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1bOA": "up", "\x1bOB": "down",
+	"\x1b[5~": "pgup", "\x1b[6~": "pgdn",
+	"\x1b[H": "home", "\x1b[F": "end", "\x1bOH": "home", "\x1bOF": "end",
+	"\x1b[1~": "home", "\x1b[4~": "end",
+}
+
+// decodeKeys splits what was read from the terminal into key presses.
+// A lone ESC is the Escape key; unknown escape sequences are dropped.
+func decodeKeys(b []byte) []tuiKey {
+	var keys []tuiKey
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == 0x1b:
+			if i+1 == len(b) {
+				keys = append(keys, tuiKey{name: "esc"})
+				i++
+				continue
+			}
+			end := skipEscape(string(b), i)
+			if name, ok := escapeKeys[string(b[i:end])]; ok {
+				keys = append(keys, tuiKey{name: name})
+			}
+			i = end
+		case c == '\r' || c == '\n':
+			keys = append(keys, tuiKey{name: "enter"})
+			i++
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, tuiKey{name: "backspace"})
+			i++
+		case c == 0x03:
+			keys = append(keys, tuiKey{name: "ctrl-c"})
+			i++
+		case c == 0x15:
+			keys = append(keys, tuiKey{name: "ctrl-u"})
+			i++
+		case c < 0x20:
+			i++ // other control keys are ignored
+		default:
+			r, size := utf8.DecodeRune(b[i:])
+			keys = append(keys, tuiKey{r: r})
+			i += size
+		}
+	}
+	return keys
+}
+
+// tuiTerminal puts the terminal in raw mode on the alternate screen for the viewer.
+type tuiTerminal struct {
+	in    *os.File
+	out   *bufio.Writer
+	saved *term.State
+}
+
+func openTUITerminal(in *os.File, out io.Writer) (*tuiTerminal, error) {
+	saved, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot switch the terminal to raw mode: %w", err)
+	}
+	t := &tuiTerminal{in: in, out: bufio.NewWriter(out), saved: saved}
+	// Alternate screen, hidden cursor
+	t.out.WriteString("\x1b[?1049h\x1b[?25l")
+	t.out.Flush()
+	return t, nil
+}
+
+// close restores the screen and the terminal settings.
+func (t *tuiTerminal) close() {
+	t.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	t.out.Flush()
+	term.Restore(int(t.in.Fd()), t.saved)
+}
+
+// size returns the terminal's width and height, defaulting to 80x24.
+func (t *tuiTerminal) size() (width, height int) {
+	if width, height, err := term.GetSize(int(t.in.Fd())); err == nil && width > 0 && height > 0 {
+		return width, height
+	}
+	return 80, 24
+}
+
+// draw replaces the screen content with lines.
+func (t *tuiTerminal) draw(lines []string) {
+	t.out.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			t.out.WriteString("\r\n")
+		}
+		t.out.WriteString(line)
+		t.out.WriteString("\x1b[0m\x1b[K")
+	}
+	t.out.WriteString("\x1b[J")
+	t.out.Flush()
+}
+
+// keys reads key presses until the terminal is closed.
+func (t *tuiTerminal) keys() <-chan tuiKey {
+	keys := make(chan tuiKey, 16)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 256)
+		for {
+			n, err := t.in.Read(buf)
+			for _, k := range decodeKeys(buf[:n]) {
+				keys <- k
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return keys
+}
+
+// resizes notifies window size changes, on platforms with a signal for them (resizeSignals).
+func (t *tuiTerminal) resizes() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	if len(resizeSignals) > 0 {
+		signal.Notify(ch, resizeSignals...)
+	}
+	return ch
+}
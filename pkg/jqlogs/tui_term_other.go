@@ -0,0 +1,9 @@
+//go:build !unix
+
+package jqlogs
+
+import "os"
+
+// resizeSignals is empty where no signal reports window size changes (e.g. Windows);
+// the viewer then keeps the size it started with.
+var resizeSignals []os.Signal
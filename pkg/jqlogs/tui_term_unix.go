@@ -0,0 +1,11 @@
+//go:build unix
+
+package jqlogs
+
+import (
+	"os"
+	"syscall"
+)
+
+// resizeSignals are the signals sent when the terminal window is resized.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
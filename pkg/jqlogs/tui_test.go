@@ -0,0 +1,196 @@
+package jqlogs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestTUI creates a monochrome viewer fed with lines
+func newTestTUI(t *testing.T, query string, maxRecords int, lines ...string) *tuiModel {
+	t.Helper()
+	m, err := newTUIModel(query, JqFlagOptions{Monochrome: true}, maxRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		m.add(newTUIRecord(line, strings.HasPrefix(line, "{"), DefaultLevelFields))
+	}
+	return m
+}
+
+// rowTexts returns the texts of the rows in the view
+func rowTexts(m *tuiModel) []string {
+	var texts []string
+	for _, row := range m.rows {
+		texts = append(texts, row.text)
+	}
+	return texts
+}
+
+// typeKeys sends every rune of s, then the named keys
+func typeKeys(m *tuiModel, s string, names ...string) {
+	for _, r := range s {
+		m.handleKey(tuiKey{r: r})
+	}
+	for _, name := range names {
+		m.handleKey(tuiKey{name: name})
+	}
+}
+
+var tuiTestLines = []string{
+	`{"level":"info","msg":"started"}`,
+	`{"level":"error","msg":"failed","code":500}`,
+	"plain text",
+	`{"level":"info","msg":"done"}`,
+}
+
+func TestTUIModel_Filter(t *testing.T) {
+	m := newTestTUI(t, ".msg", 100, tuiTestLines...)
+	if got, want := rowTexts(m), []string{"started", "failed", "plain text", "done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	// Editing the filter re-evaluates the buffer as it is typed
+	typeKeys(m, ":")
+	m.handleKey(tuiKey{name: "ctrl-u"})
+	typeKeys(m, `select(.level == "error") | .code`)
+	if got, want := rowTexts(m), []string{"500", "plain text"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	// An incomplete query keeps the last good rows and reports the error
+	typeKeys(m, " |")
+	if m.filterErr == nil || len(m.rows) != 2 {
+		t.Errorf("filterErr = %v, rows = %q, want error and previous rows", m.filterErr, rowTexts(m))
+	}
+
+	// Escape restores the filter from before editing
+	typeKeys(m, "", "esc")
+	if m.filter != ".msg" || m.mode != tuiModeNormal || len(m.rows) != 4 {
+		t.Errorf("filter = %q, mode = %v, rows = %q, want .msg restored", m.filter, m.mode, rowTexts(m))
+	}
+}
+
+func TestTUIModel_SmartQueryAndObjects(t *testing.T) {
+	m := newTestTUI(t, ".level .msg", 100, tuiTestLines[:2]...)
+	if got, want := rowTexts(m), []string{"info started", "error failed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	m.setFilter(`{msg, url: "a&b"}`)
+	if got, want := rowTexts(m), []string{`{"msg":"started","url":"a&b"}`, `{"msg":"failed","url":"a&b"}`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestTUIModel_BoundedBuffer(t *testing.T) {
+	m := newTestTUI(t, ".msg", 2, tuiTestLines...)
+	if got, want := rowTexts(m), []string{"plain text", "done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	if len(m.records) != 2 || m.first != 2 {
+		t.Errorf("records = %d, first = %d, want the 2 latest", len(m.records), m.first)
+	}
+	if m.cursor != 1 {
+		t.Errorf("cursor = %d, want it to follow the last row", m.cursor)
+	}
+}
+
+func TestTUIModel_Pause(t *testing.T) {
+	m := newTestTUI(t, ".msg", 100, tuiTestLines[:2]...)
+	m.handleKey(tuiKey{r: 'p'})
+	m.add(newTUIRecord(tuiTestLines[3], true, DefaultLevelFields))
+	if len(m.rows) != 2 || len(m.pending) != 1 {
+		t.Fatalf("rows = %q, pending = %d, want the view frozen", rowTexts(m), len(m.pending))
+	}
+	if status := m.render()[m.height-1]; !strings.Contains(status, "PAUSED +1") {
+		t.Errorf("status = %q, want PAUSED +1", status)
+	}
+
+	m.handleKey(tuiKey{r: 'p'})
+	if got, want := rowTexts(m), []string{"started", "failed", "done"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestTUIModel_Search(t *testing.T) {
+	m := newTestTUI(t, ".msg", 100, tuiTestLines...)
+	m.handleKey(tuiKey{name: "home"})
+
+	typeKeys(m, "/DON", "enter")
+	if m.cursor != 3 {
+		t.Errorf("cursor = %d, want 3 (done)", m.cursor)
+	}
+	m.opts.Monochrome = false
+	if line := m.render()[4]; !strings.Contains(line, highlightOn+"don"+highlightOff) {
+		t.Errorf("line = %q, want the match highlighted", line)
+	}
+
+	m.search = "t"
+	m.handleKey(tuiKey{r: 'N'})
+	if m.cursor != 2 {
+		t.Errorf("cursor = %d, want 2 (plain text)", m.cursor)
+	}
+
+	typeKeys(m, "/nope", "enter")
+	if m.cursor != 2 || !strings.Contains(m.notice, "pattern not found") {
+		t.Errorf("cursor = %d, notice = %q, want cursor kept and a notice", m.cursor, m.notice)
+	}
+}
+
+func TestTUIModel_Render(t *testing.T) {
+	m, err := newTUIModel(".msg", JqFlagOptions{}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.width, m.height = 30, 8
+	for _, line := range tuiTestLines {
+		m.add(newTUIRecord(line, strings.HasPrefix(line, "{"), DefaultLevelFields))
+	}
+	m.handleKey(tuiKey{r: 'k'})
+	m.handleKey(tuiKey{r: 'k'})
+	m.handleKey(tuiKey{name: "enter"})
+
+	lines := m.render()
+	if len(lines) != m.height {
+		t.Fatalf("render() = %d lines, want %d", len(lines), m.height)
+	}
+	// Rows are colored by level, the selected one is expanded to pretty JSON
+	// and scrolled so that the expansion fits
+	if want := "\x1b[31mfailed"; !strings.Contains(lines[1], want) {
+		t.Errorf("line 1 = %q, want red failed", lines[1])
+	}
+	if !strings.HasPrefix(lines[1], "> ") {
+		t.Errorf("line 1 = %q, want the cursor marker", lines[1])
+	}
+	if got := stripEscapes(lines[2]); got != "    {" {
+		t.Errorf("line 2 = %q, want the expansion", got)
+	}
+	if got := stripEscapes(lines[3]); got != `      "code": 500,` {
+		t.Errorf("line 3 = %q, want the expansion", got)
+	}
+	// Lines are cut at the terminal width
+	for i, line := range lines {
+		if w := len([]rune(stripEscapes(line))); w > m.width {
+			t.Errorf("line %d is %d wide, want at most %d", i, w, m.width)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	if got, want := sanitize("a\nb\tc\x1b[2J"), "a⏎b c�[2J"; got != want {
+		t.Errorf("sanitize() = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	got := decodeKeys([]byte("a\x1b[A\x1b[6~\r\x7f\x03é\x1b[99~\x1b"))
+	want := []tuiKey{
+		{r: 'a'}, {name: "up"}, {name: "pgdn"}, {name: "enter"},
+		{name: "backspace"}, {name: "ctrl-c"}, {r: 'é'}, {name: "esc"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeKeys() = %+v, want %+v", got, want)
+	}
+}
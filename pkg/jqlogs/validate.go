@@ -0,0 +1,99 @@
+package jqlogs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/itchyny/gojq"
+	"github.com/mattn/go-runewidth"
+)
+
+// QueryErrorExitCode is the exit status for an invalid query, as with jq.
+const QueryErrorExitCode = 3
+
+// compileErrorRegexp matches the compile errors of gojq that name what is not defined.
+var compileErrorRegexp = regexp.MustCompile(`^(?:function|variable|format|label) not defined: (\S+?)(?:/\d+)?$`)
+
+// QueryError is an invalid query, located in the query as it was typed when possible.
+type QueryError struct {
+	Query  string
+	Offset int // byte offset of the error in Query, -1 when unknown
+	Err    error
+}
+
+// Error prints the message, followed by the line of the query with a caret under the error.
+func (e *QueryError) Error() string {
+	if e.Offset < 0 {
+		return "invalid query: " + e.Err.Error()
+	}
+	offset := min(e.Offset, len(e.Query))
+	start := strings.LastIndexByte(e.Query[:offset], '\n') + 1
+	end := len(e.Query)
+	if i := strings.IndexByte(e.Query[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	where := ""
+	if strings.Contains(e.Query, "\n") {
+		where = fmt.Sprintf(" (line %d)", strings.Count(e.Query[:start], "\n")+1)
+	}
+	return fmt.Sprintf("invalid query%s: %v\n    %s\n    %s^", where, e.Err,
+		e.Query[start:end], strings.Repeat(" ", runewidth.StringWidth(e.Query[start:offset])))
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateQuery parses and compiles query as the jq process will run it (Smart Query,
+// pre-processing, ...), so that mistakes are reported before kubectl starts.
+// The error is a *QueryError.
+func ValidateQuery(query string, opts JqFlagOptions) error {
+	logic := query
+	if logic == "" {
+		logic = "."
+	}
+	if opts.KeyValue {
+		logic = SmartQueryKeyValue(logic)
+	} else {
+		logic = SmartQuery(logic)
+	}
+
+	// Errors are only located in the query as it was typed: once macros or Smart Query
+	// rewrote it, the offsets point into text the user has never seen
+	typed := logic == query && (opts.typedQuery == "" || opts.typedQuery == query)
+
+	// Syntax errors are located in the query alone
+	if _, err := gojq.Parse(logic); err != nil {
+		qe := &QueryError{Query: query, Offset: -1, Err: err}
+		var pe *gojq.ParseError
+		if typed && errors.As(err, &pe) {
+			qe.Offset = max(pe.Offset-len(pe.Token), 0)
+		}
+		return qe
+	}
+
+	// Undefined functions and variables are only found by compiling the whole program
+	if _, err := compileJq(query, opts); err != nil {
+		qe := &QueryError{Query: query, Offset: -1, Err: err}
+		if typed {
+			qe.Offset = locateName(query, err)
+		}
+		return qe
+	}
+	return nil
+}
+
+// locateName returns the offset in query of the name a compile error is about, or -1.
+func locateName(query string, err error) int {
+	m := compileErrorRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return -1
+	}
+	re := regexp.MustCompile(`(?:^|[^\w.$@])(` + regexp.QuoteMeta(m[1]) + `)\b`)
+	if loc := re.FindStringSubmatchIndex(query); loc != nil {
+		return loc[2]
+	}
+	return -1
+}
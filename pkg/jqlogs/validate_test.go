@@ -0,0 +1,82 @@
+package jqlogs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		opts    JqFlagOptions
+		wantErr string
+	}{
+		{name: "Empty", query: ""},
+		{name: "Valid", query: `select(.level == "error") | .msg`},
+		{name: "Smart Query", query: ".level .msg|upper:5"},
+		{name: "Envelope With Unwrap", query: "$envelope.stream", opts: JqFlagOptions{Unwrap: true}},
+		{name: "CLI Builtins", query: ". | debug | stderr | input_filename"},
+		{
+			name:    "Unexpected Token",
+			query:   ".msg | )",
+			wantErr: "invalid query: unexpected token \")\"\n    .msg | )\n           ^",
+		},
+		{
+			name:    "Unexpected End",
+			query:   "select(.a ==",
+			wantErr: "invalid query: unexpected EOF\n    select(.a ==\n                ^",
+		},
+		{
+			name:    "Multi-line Query",
+			query:   "select(.a)\n| .b |= (",
+			wantErr: "invalid query (line 2): unexpected EOF\n    | .b |= (\n             ^",
+		},
+		{
+			name:    "Undefined Function",
+			query:   "select(.a) | lenght",
+			wantErr: "invalid query: function not defined: lenght/0\n    select(.a) | lenght\n                 ^",
+		},
+		{
+			name:    "Expanded Macro",
+			query:   "(.a | nope)",
+			opts:    JqFlagOptions{typedQuery: "@macro"},
+			wantErr: "invalid query: function not defined: nope/0",
+		},
+		{
+			name:    "Expanded Macro Syntax Error",
+			query:   "(.a | ) | .b",
+			opts:    JqFlagOptions{typedQuery: "@macro | .b"},
+			wantErr: "invalid query: unexpected token \")\"",
+		},
+		{
+			name:    "Paths Then Unknown Function",
+			query:   ".a .b|nope",
+			wantErr: "invalid query: function not defined: nope/0\n    .a .b|nope\n          ^",
+		},
+		{
+			name:    "Envelope Without Unwrap",
+			query:   ".msg, $envelope.stream",
+			wantErr: "invalid query: variable not defined: $envelope\n    .msg, $envelope.stream\n          ^",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateQuery(tt.query, tt.opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateQuery(%q) = %v, want nil", tt.query, err)
+				}
+				return
+			}
+			var qe *QueryError
+			if !errors.As(err, &qe) {
+				t.Fatalf("ValidateQuery(%q) = %v, want a *QueryError", tt.query, err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("ValidateQuery(%q) =\n%s\nwant\n%s", tt.query, err, tt.wantErr)
+			}
+		})
+	}
+}
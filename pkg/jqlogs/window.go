@@ -0,0 +1,195 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// windowTick is how often open windows are checked for closing while the stream is quiet.
+const windowTick = time.Second
+
+// ParseDuration validates the value of a duration flag, like --window or --merge-lateness.
+func ParseDuration(s string, allowZero bool) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		return 0, fmt.Errorf("requires a positive duration like 1m or 30s, got: %q", s)
+	}
+	return d, nil
+}
+
+// windowSlide returns the --window-slide, or the window size for tumbling windows.
+func (o JqFlagOptions) windowSlide() time.Duration {
+	if o.WindowSlide > 0 {
+		return o.WindowSlide
+	}
+	return o.Window
+}
+
+// RunWindow groups the JSON records of the stream into time windows by their timestamp
+// (--window) and runs the query over the array of each window when it closes. Plain text
+// lines are printed as they come. Returns exit code.
+func (r *Runner) RunWindow(kubectlArgs []string, jqQuery string, opts JqFlagOptions) int {
+	if err := ValidateQuery(jqQuery, opts); err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return QueryErrorExitCode
+	}
+	filter, err := newStreamFilter(opts)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// jq gets one input per window and reports a failing query itself
+	opts.Strict = false
+	w := newWindower(opts.Window, opts.windowSlide(), opts.WindowGrace, opts.timeFields())
+	exitCode := r.process(jqQuery, opts, func(emit func(line []byte, number int, isJSON bool)) {
+		var mu sync.Mutex // the stream and the ticker both close windows
+		emitWindows := func(windows [][]byte) {
+			for _, window := range windows {
+				emit(window, 0, true)
+			}
+		}
+
+		// Windows also close while the stream is quiet, as time goes by
+		done := make(chan struct{})
+		ticked := make(chan struct{})
+		go func() {
+			defer close(ticked)
+			ticker := time.NewTicker(windowTick)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case now := <-ticker.C:
+					mu.Lock()
+					emitWindows(w.advance(now))
+					mu.Unlock()
+				}
+			}
+		}()
+
+		r.stream(kubectlArgs, filter, func(line []byte, number int, isJSON bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			windows, ok := w.add(line, isJSON, time.Now())
+			if !ok {
+				emit(line, number, false)
+			}
+			emitWindows(windows)
+		})
+		close(done)
+		<-ticked
+		emitWindows(w.flush())
+	})
+	w.report(r)
+	return exitCode
+}
+
+// windower assigns records to time windows [start, start+size), starting every slide
+// (tumbling windows when slide == size). A window closes when the watermark, the latest
+// record time minus the grace period, passes its end. While no records come, the watermark
+// moves on with the clock. Records that only belong to closed windows are late and dropped.
+type windower struct {
+	size, slide, grace time.Duration
+	fields             []string
+
+	open        map[int64]*slurper // by start, in UnixNano
+	latest      time.Time          // latest record time seen
+	arrived     time.Time          // when that record was read
+	closedUntil time.Time          // windows ending at or before this are closed
+
+	late, untimed int
+}
+
+func newWindower(size, slide, grace time.Duration, fields []string) *windower {
+	return &windower{size: size, slide: slide, grace: grace, fields: fields, open: map[int64]*slurper{}}
+}
+
+// add puts a record into its windows and returns the windows that closed, as JSON inputs
+// for the query. It reports false for lines that are not windowed (text lines), to be
+// printed as they are.
+func (w *windower) add(line []byte, isJSON bool, now time.Time) ([][]byte, bool) {
+	if !isJSON {
+		return nil, false
+	}
+	t, ok := recordTime(line, w.fields)
+	if !ok {
+		if json.Valid(line) {
+			w.untimed++
+			return nil, true
+		}
+		return nil, false // not JSON after all
+	}
+
+	added := false
+	first := t.Add(-w.size).Truncate(w.slide).Add(w.slide)
+	for start := first; !start.After(t); start = start.Add(w.slide) {
+		if !start.Add(w.size).After(w.closedUntil) {
+			continue // closed already
+		}
+		s := w.open[start.UnixNano()]
+		if s == nil {
+			s = newSlurper(false)
+			w.open[start.UnixNano()] = s
+		}
+		s.add(line, true)
+		added = true
+	}
+	if !added {
+		w.late++
+	}
+	if t.After(w.latest) {
+		w.latest, w.arrived = t, now
+	}
+	return w.advance(now), true
+}
+
+// advance closes the windows ending before the watermark at now.
+func (w *windower) advance(now time.Time) [][]byte {
+	if w.latest.IsZero() {
+		return nil
+	}
+	watermark := w.latest.Add(now.Sub(w.arrived)).Add(-w.grace)
+	return w.close(func(end time.Time) bool { return !end.After(watermark) })
+}
+
+// flush closes all the windows, at the end of the stream.
+func (w *windower) flush() [][]byte {
+	return w.close(func(time.Time) bool { return true })
+}
+
+func (w *windower) close(ended func(end time.Time) bool) [][]byte {
+	var starts []int64
+	for start := range w.open {
+		if ended(time.Unix(0, start).Add(w.size)) {
+			starts = append(starts, start)
+		}
+	}
+	slices.Sort(starts)
+	windows := make([][]byte, 0, len(starts))
+	for _, start := range starts {
+		from := time.Unix(0, start).UTC()
+		to := from.Add(w.size)
+		windows = append(windows, fmt.Appendf(nil, `{"start":%q,"end":%q,"records":%s}`,
+			from.Format(time.RFC3339Nano), to.Format(time.RFC3339Nano), w.open[start].array()))
+		delete(w.open, start)
+		if to.After(w.closedUntil) {
+			w.closedUntil = to
+		}
+	}
+	return windows
+}
+
+// report prints the number of records left out of the windows, if any.
+func (w *windower) report(r *Runner) {
+	if w.late > 0 {
+		fmt.Fprintf(r.Stderr, "[jqlogs] %d late records dropped by --window (see --window-grace)\n", w.late)
+	}
+	if w.untimed > 0 {
+		fmt.Fprintf(r.Stderr, "[jqlogs] %d records without a timestamp left out of --window (see --time-fields)\n", w.untimed)
+	}
+}
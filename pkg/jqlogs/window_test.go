@@ -0,0 +1,165 @@
+package jqlogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	if d, err := ParseDuration("1m", false); err != nil || d != time.Minute {
+		t.Errorf("ParseDuration(1m) = %v, %v", d, err)
+	}
+	if d, err := ParseDuration("0s", true); err != nil || d != 0 {
+		t.Errorf("ParseDuration(0s, allowZero) = %v, %v", d, err)
+	}
+	for _, s := range []string{"0s", "-1m", "1", "soon"} {
+		if _, err := ParseDuration(s, false); err == nil {
+			t.Errorf("ParseDuration(%q) expected error", s)
+		}
+	}
+}
+
+// windowSummary is a closed window as the query sees it, with the "n" of its records
+type windowSummary struct {
+	Start   string
+	Records []int
+}
+
+func summarizeWindows(t *testing.T, windows [][]byte) []windowSummary {
+	t.Helper()
+	var summaries []windowSummary
+	for _, w := range windows {
+		var window struct {
+			Start   string
+			Records []struct{ N int }
+		}
+		if err := json.Unmarshal(w, &window); err != nil {
+			t.Fatalf("window %s: %v", w, err)
+		}
+		s := windowSummary{Start: window.Start[11:19]}
+		for _, r := range window.Records {
+			s.Records = append(s.Records, r.N)
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+func TestWindower(t *testing.T) {
+	// Records (n, seconds past midnight) in the order they arrive
+	records := []struct{ n, sec int }{{1, 5}, {2, 30}, {3, 70}, {4, 50}, {5, 130}}
+	tests := []struct {
+		name        string
+		slide       time.Duration
+		grace       time.Duration
+		wantClosed  []windowSummary // while streaming
+		wantFlushed []windowSummary // at the end
+		wantLate    int
+	}{
+		{
+			name:        "Tumbling",
+			wantClosed:  []windowSummary{{"00:00:00", []int{1, 2}}, {"00:01:00", []int{3}}},
+			wantFlushed: []windowSummary{{"00:02:00", []int{5}}},
+			wantLate:    1,
+		},
+		{
+			name:        "Grace Period",
+			grace:       30 * time.Second,
+			wantClosed:  []windowSummary{{"00:00:00", []int{1, 2, 4}}},
+			wantFlushed: []windowSummary{{"00:01:00", []int{3}}, {"00:02:00", []int{5}}},
+		},
+		{
+			name:  "Sliding",
+			slide: 30 * time.Second,
+			wantClosed: []windowSummary{
+				{"23:59:30", []int{1}}, {"00:00:00", []int{1, 2}},
+				{"00:00:30", []int{2, 3, 4}}, {"00:01:00", []int{3}},
+			},
+			wantFlushed: []windowSummary{{"00:01:30", []int{5}}, {"00:02:00", []int{5}}},
+		},
+	}
+
+	midnight := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slide := tt.slide
+			if slide == 0 {
+				slide = time.Minute
+			}
+			w := newWindower(time.Minute, slide, tt.grace, DefaultTimeFields)
+			now := time.Now()
+			var closed [][]byte
+			for _, r := range records {
+				ts := midnight.Add(time.Duration(r.sec) * time.Second).Format(time.RFC3339)
+				windows, ok := w.add([]byte(fmt.Sprintf(`{"n":%d,"ts":%q}`, r.n, ts)), true, now)
+				if !ok {
+					t.Fatalf("record %d was not windowed", r.n)
+				}
+				closed = append(closed, windows...)
+			}
+			if got := summarizeWindows(t, closed); !reflect.DeepEqual(got, tt.wantClosed) {
+				t.Errorf("closed windows = %v, want %v", got, tt.wantClosed)
+			}
+			if got := summarizeWindows(t, w.flush()); !reflect.DeepEqual(got, tt.wantFlushed) {
+				t.Errorf("flushed windows = %v, want %v", got, tt.wantFlushed)
+			}
+			if w.late != tt.wantLate {
+				t.Errorf("late = %d, want %d", w.late, tt.wantLate)
+			}
+		})
+	}
+}
+
+func TestWindower_Lines(t *testing.T) {
+	w := newWindower(time.Minute, time.Minute, 0, DefaultTimeFields)
+	now := time.Now()
+	if _, ok := w.add([]byte("plain text"), false, now); ok {
+		t.Error("text line was windowed")
+	}
+	if _, ok := w.add([]byte("[INFO] starting"), true, now); ok {
+		t.Error("line that is not JSON was windowed")
+	}
+	if _, ok := w.add([]byte(`{"msg":"no time"}`), true, now); !ok || w.untimed != 1 {
+		t.Errorf("record without a timestamp: ok = %v, untimed = %d, want it left out and counted", ok, w.untimed)
+	}
+
+	// While the stream is quiet, windows close as time goes by
+	w.add([]byte(`{"ts":"2026-01-01T00:00:10Z"}`), true, now)
+	if windows := w.advance(now.Add(30 * time.Second)); len(windows) != 0 {
+		t.Errorf("advance(+30s) closed %d windows, want 0", len(windows))
+	}
+	if windows := w.advance(now.Add(50 * time.Second)); len(windows) != 1 {
+		t.Errorf("advance(+50s) closed %d windows, want 1", len(windows))
+	}
+}
+
+func TestRunner_RunWindow(t *testing.T) {
+	var stdout lockedBuffer
+	runner := &Runner{
+		Stdout: &stdout,
+		Stderr: io.Discard,
+		ExecKubectl: func(args []string, out io.Writer, err io.Writer) error {
+			io.WriteString(out, `{"ts":"2026-01-01T00:00:05Z","level":"error"}`+"\n"+
+				`{"ts":"2026-01-01T00:00:30Z","level":"info"}`+"\n"+
+				`{"ts":"2026-01-01T00:01:10Z","level":"error"}`+"\n")
+			return nil
+		},
+		ExecJq: NewDefaultRunner().ExecJq,
+	}
+
+	opts := JqFlagOptions{Compact: true, Window: time.Minute}
+	query := `{start: $window.start, errors: map(select(.level == "error")) | length}`
+	if exitCode := runner.RunWindow(nil, query, opts); exitCode != 0 {
+		t.Errorf("exit code = %d, want 0", exitCode)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	want := `{"errors":1,"start":"2026-01-01T00:00:00Z"}` + "\n" + `{"errors":1,"start":"2026-01-01T00:01:00Z"}` + "\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}